@@ -0,0 +1,262 @@
+package rorm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+//redis:"primary;auto:incr" 等主键在Create时为零值则自动生成 生成的值在写入前写回model
+//incr 每个类型一个INCR计数器 整数或字符串字段 CreateMany每批数据只执行一次INCRBY
+//uuid 随机生成的UUID v4 字符串字段
+//ulid 按时间排序的ULID 字符串字段
+//snowflake 时间戳 节点ID与序号组成的64位整数 整数或字符串字段 节点ID通过SetSnowflakeNode设置
+
+const (
+	AutoIncr      = "incr"
+	AutoUUID      = "uuid"
+	AutoULID      = "ulid"
+	AutoSnowflake = "snowflake"
+)
+
+var ErrAutoKeyNotSupported = errors.New("auto primary key not supported")
+
+//fillAutoKeys 为v中设置了auto的零值主键生成值 UpdateOnly时不生成 零值主键的数据不存在
+func (query *Query) fillAutoKeys(ctx context.Context, v interface{}) error {
+	val := reflect.ValueOf(v)
+	if query.CreateMode == UpdateOnly || val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	schema := getSchema(val.Type())
+	for _, primary := range schema.Primaries {
+		auto, ok := primary.Tags["auto"]
+		if !ok {
+			continue
+		}
+		field := fieldByIndex(val.Elem(), primary.Index, false)
+		if !field.IsValid() || !field.IsZero() {
+			continue
+		}
+		if err := query.generateKey(ctx, schema, primary, auto, field); err != nil {
+			return fmt.Errorf("generate %s: %w", primary.Name, err)
+		}
+	}
+	return nil
+}
+
+//reserveAutoIncr 为models中auto:incr的零值主键预留连续的值 每个计数器只执行一次INCRBY
+//CreateMany使用 避免每条数据一次INCR errs与models一一对应 为生成的值超出字段范围的错误
+func (query *Query) reserveAutoIncr(ctx context.Context, models []interface{}) (errs []error, err error) {
+	type counter struct {
+		key    string
+		name   string
+		fields []reflect.Value
+		models []int
+		cmd    *redis.Cmd
+	}
+	errs = make([]error, len(models))
+	var counters []*counter
+	byKey := map[string]*counter{}
+	for i, model := range models {
+		val := reflect.ValueOf(model)
+		if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		schema := getSchema(val.Type())
+		for _, primary := range schema.Primaries {
+			if primary.Tags["auto"] != AutoIncr {
+				continue
+			}
+			field := fieldByIndex(val.Elem(), primary.Index, false)
+			if !field.IsValid() || !field.IsZero() || !(isIntegerKind(field.Kind()) || field.Kind() == reflect.String) {
+				continue
+			}
+			key := query.autoIncrKey(schema.Name, primary.Stored)
+			c, ok := byKey[key]
+			if !ok {
+				c = &counter{key: key, name: primary.Name}
+				byKey[key] = c
+				counters = append(counters, c)
+			}
+			c.fields = append(c.fields, field)
+			c.models = append(c.models, i)
+		}
+	}
+	if len(counters) == 0 {
+		return
+	}
+
+	pipe := query.client.Pipeline()
+	for _, c := range counters {
+		c.cmd = pipe.Do(ctx, "incrby", c.key, len(c.fields))
+	}
+	if _, err = pipe.Exec(ctx); err != nil {
+		return
+	}
+	for _, c := range counters {
+		var last int64
+		if last, err = c.cmd.Int64(); err != nil {
+			return
+		}
+		first := last - int64(len(c.fields)) + 1
+		for i, field := range c.fields {
+			if keyErr := setKeyValue(field, uint64(first+int64(i))); keyErr != nil && errs[c.models[i]] == nil {
+				errs[c.models[i]] = fmt.Errorf("generate %s: %w", c.name, keyErr)
+			}
+		}
+	}
+	return
+}
+
+//generateKey 按auto的方式生成主键并写入field
+func (query *Query) generateKey(ctx context.Context, schema *ModelSchema, primary *SchemaField, auto string, field reflect.Value) error {
+	kind := field.Kind()
+	switch {
+	case auto == AutoIncr && (isIntegerKind(kind) || kind == reflect.String):
+		id, err := query.client.Do(ctx, "incr", query.autoIncrKey(schema.Name, primary.Stored)).Int64()
+		if err != nil {
+			return err
+		}
+		return setKeyValue(field, uint64(id))
+	case auto == AutoSnowflake && (isIntegerKind(kind) || kind == reflect.String):
+		return setKeyValue(field, uint64(snowflakes.next()))
+	case auto == AutoUUID && kind == reflect.String:
+		id, err := newUUID()
+		field.SetString(id)
+		return err
+	case auto == AutoULID && kind == reflect.String:
+		id, err := newULID(time.Now())
+		field.SetString(id)
+		return err
+	}
+	return fmt.Errorf("%w: auto:%s on %s field", ErrAutoKeyNotSupported, auto, field.Type())
+}
+
+//autoIncrKey auto:incr使用的计数器 与范围索引一样存放在索引的前缀下 Rekey时一起移动
+func (query *Query) autoIncrKey(model string, field string) string {
+	return query.namer().IndexKey(model, field, []string{AutoIncr})
+}
+
+//setKeyValue 将生成的整数写入整数或字符串字段 超出字段的范围时返回错误
+func setKeyValue(field reflect.Value, id uint64) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(strconv.FormatUint(id, 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if field.OverflowUint(id) {
+			return fmt.Errorf("generated key %d overflows %s", id, field.Type())
+		}
+		field.SetUint(id)
+	default:
+		if id > 1<<63-1 || field.OverflowInt(int64(id)) {
+			return fmt.Errorf("generated key %d overflows %s", id, field.Type())
+		}
+		field.SetInt(int64(id))
+	}
+	return nil
+}
+
+//newUUID 生成UUID v4
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	s := hex.EncodeToString(b[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+//newULID 生成ULID 48位毫秒时间戳加80位随机数 使用Crockford base32编码为26个字符
+func newULID(t time.Time) (string, error) {
+	var b [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	b[0], b[1] = byte(ms>>40), byte(ms>>32)
+	binary.BigEndian.PutUint32(b[2:], uint32(ms))
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+	//128位从高位开始每5位一个字符 第一个字符只有3位
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	snowflakeMaxNode  = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq   = 1<<snowflakeSeqBits - 1
+)
+
+//snowflakeEpoch snowflake时间戳的起点
+var snowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+//snowflake 41位毫秒时间戳 10位节点ID 12位序号
+type snowflake struct {
+	mu   sync.Mutex
+	node int64
+	last int64
+	seq  int64
+}
+
+//snowflakes 进程内共用的snowflake生成器 节点ID默认随机
+var snowflakes = newSnowflake()
+
+func newSnowflake() *snowflake {
+	var b [2]byte
+	_, _ = rand.Read(b[:])
+	return &snowflake{node: int64(binary.BigEndian.Uint16(b[:])) & snowflakeMaxNode}
+}
+
+//SetSnowflakeNode 设置auto:snowflake使用的节点ID 范围为0-1023
+//默认的节点ID是随机的 多个进程写入同一类型时应该为每个进程设置不同的ID
+func SetSnowflakeNode(node int64) {
+	if node < 0 || node > snowflakeMaxNode {
+		panic("snowflake node must be between 0 and 1023")
+	}
+	snowflakes.mu.Lock()
+	snowflakes.node = node
+	snowflakes.mu.Unlock()
+}
+
+func (s *snowflake) next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Since(snowflakeEpoch).Milliseconds()
+	if now < s.last {
+		//时钟回拨时继续使用上一个时间戳
+		now = s.last
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & snowflakeMaxSeq
+		if s.seq == 0 {
+			//同一毫秒内序号用完 等待下一毫秒
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Since(snowflakeEpoch).Milliseconds()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = now
+	return now<<(snowflakeNodeBits+snowflakeSeqBits) | s.node<<snowflakeSeqBits | s.seq
+}
@@ -0,0 +1,172 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type AutoIncrTest struct {
+	ID   int64 `redis:"primary;auto:incr"`
+	Name string
+}
+
+type AutoKeysTest struct {
+	UUID      string `redis:"primary;auto:uuid"`
+	ULID      string `redis:"primary;auto:ulid"`
+	Snowflake uint64 `redis:"primary;auto:snowflake"`
+	Seq       string `redis:"primary;auto:incr"`
+}
+
+type AutoInvalidTest struct {
+	ID int `redis:"primary;auto:uuid"`
+}
+
+type AutoIncrManyTest struct {
+	ID   uint32 `redis:"primary;auto:incr"`
+	Name string
+}
+
+type AutoIncrSmallTest struct {
+	ID uint8 `redis:"primary;auto:incr"`
+}
+
+type AutoRekeyTest struct {
+	ID int `redis:"primary;auto:incr"`
+}
+
+func TestQuery_CreateAutoKey(t *testing.T) {
+	ctx := context.Background()
+	first := &AutoIncrTest{Name: "a"}
+	err := redisClient.NewQuery().Create(ctx, first)
+	assert.Nil(t, err)
+	assert.NotZero(t, first.ID)
+	second := &AutoIncrTest{Name: "b"}
+	err = redisClient.NewQuery().Mode(InsertOnly).Create(ctx, second)
+	assert.Nil(t, err)
+	assert.Equal(t, first.ID+1, second.ID)
+
+	result := &AutoIncrTest{ID: second.ID}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, second, result)
+
+	//非零值的主键不会被替换
+	fixed := &AutoIncrTest{ID: 1000, Name: "c"}
+	err = redisClient.NewQuery().Create(ctx, fixed)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1000), fixed.ID)
+
+	models := []*AutoKeysTest{{}, {}}
+	errs, err := redisClient.NewQuery().CreateMany(ctx, models)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil}, errs)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), models[0].UUID)
+	assert.Regexp(t, regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`), models[0].ULID)
+	assert.NotEqual(t, models[0].UUID, models[1].UUID)
+	assert.Less(t, models[0].Snowflake, models[1].Snowflake)
+	assert.NotEqual(t, models[0].Seq, models[1].Seq)
+	for _, model := range models {
+		err = redisClient.NewQuery().Find(ctx, &AutoKeysTest{UUID: model.UUID, ULID: model.ULID, Snowflake: model.Snowflake, Seq: model.Seq})
+		assert.Nil(t, err)
+	}
+
+	err = redisClient.NewQuery().Create(ctx, &AutoInvalidTest{})
+	assert.True(t, errors.Is(err, ErrAutoKeyNotSupported), err)
+}
+
+func TestQuery_CreateManyAutoIncr(t *testing.T) {
+	ctx := context.Background()
+	clearModelKeys(t, ModelName(&AutoIncrManyTest{}), ModelName(&AutoIncrSmallTest{}))
+	models := []*AutoIncrManyTest{{Name: "a"}, {ID: 100, Name: "b"}, {Name: "c"}, {Name: "d"}}
+	errs, err := redisClient.NewQuery().CreateMany(ctx, models)
+	assert.Nil(t, err)
+	assert.Equal(t, []error{nil, nil, nil, nil}, errs)
+	assert.Equal(t, []uint32{1, 100, 2, 3}, []uint32{models[0].ID, models[1].ID, models[2].ID, models[3].ID})
+
+	//一批数据只预留一次 计数器为这批零值主键的数量
+	counter, err := redisClient.client.Get(ctx, redisClient.NewQuery().autoIncrKey(ModelName(&AutoIncrManyTest{}), "ID")).Int64()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), counter)
+	for _, model := range models {
+		result := &AutoIncrManyTest{ID: model.ID}
+		err = redisClient.NewQuery().Find(ctx, result)
+		assert.Nil(t, err)
+		assert.Equal(t, model, result)
+	}
+
+	//超出字段范围的数据单独返回错误
+	err = redisClient.client.Do(ctx, "set", redisClient.NewQuery().autoIncrKey(ModelName(&AutoIncrSmallTest{}), "ID"), 253).Err()
+	assert.Nil(t, err)
+	small := []*AutoIncrSmallTest{{}, {}, {}}
+	errs, err = redisClient.NewQuery().CreateMany(ctx, small)
+	assert.NotNil(t, err)
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.NotNil(t, errs[2])
+	assert.Equal(t, []uint8{254, 255, 0}, []uint8{small[0].ID, small[1].ID, small[2].ID})
+}
+
+func TestQuery_CreateUpdateOnlyAutoKey(t *testing.T) {
+	ctx := context.Background()
+	counterKey := redisClient.NewQuery().autoIncrKey(ModelName(&AutoIncrTest{}), "ID")
+	before, err := redisClient.client.Get(ctx, counterKey).Int64()
+	if err != redis.Nil {
+		assert.Nil(t, err)
+	}
+
+	//UpdateOnly不生成主键
+	model := &AutoIncrTest{Name: "update"}
+	err = redisClient.NewQuery().Mode(UpdateOnly).Create(ctx, model)
+	assert.Equal(t, RormPrimaryKeyNotFound, err)
+	assert.Zero(t, model.ID)
+	after, err := redisClient.client.Get(ctx, counterKey).Int64()
+	if err != redis.Nil {
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, before, after)
+}
+
+func TestAutoKeyGenerators(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	earlier, err := newULID(now)
+	assert.Nil(t, err)
+	later, err := newULID(now.Add(time.Millisecond))
+	assert.Nil(t, err)
+	assert.Less(t, earlier, later)
+	assert.Equal(t, "01KDYAK348", earlier[:10])
+
+	SetSnowflakeNode(7)
+	seen := map[int64]bool{}
+	last := int64(0)
+	for i := 0; i < 10000; i++ {
+		id := snowflakes.next()
+		assert.Equal(t, int64(7), id>>snowflakeSeqBits&snowflakeMaxNode)
+		if id <= last || seen[id] {
+			t.Fatalf("snowflake %d is not increasing", id)
+		}
+		seen[id], last = true, id
+	}
+	assert.Panics(t, func() { SetSnowflakeNode(1024) })
+}
+
+func TestQuery_RekeyAutoIncr(t *testing.T) {
+	ctx := context.Background()
+	oldName := ModelName(&AutoRekeyTest{})
+	clearModelKeys(t, oldName, "autorekey")
+	err := redisClient.NewQuery().Create(ctx, &AutoRekeyTest{})
+	assert.Nil(t, err)
+
+	registerTestModelName(t, &AutoRekeyTest{}, "autorekey")
+	_, err = redisClient.NewQuery().Rekey(ctx, &AutoRekeyTest{}, oldName)
+	assert.Nil(t, err)
+	model := &AutoRekeyTest{}
+	err = redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, model.ID)
+}
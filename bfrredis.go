@@ -16,6 +16,8 @@ type BFRRedis struct {
 	tmp              []byte
 	tmpMu            sync.Mutex
 	LockMap          sync.Map
+	keyProvider      KeyProvider //加密字段使用的密钥
+	keyNamer         KeyNamer    //数据与索引key的命名方式 nil时使用默认方式
 }
 
 type ExpireTime struct {
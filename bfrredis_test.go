@@ -55,6 +55,22 @@ func TestMain(m *testing.M) {
 	os.Exit(exitCode)
 }
 
+//clearModelKeys 删除名称为names的model的数据与索引 测试可以在同一个redis中重复运行
+func clearModelKeys(t *testing.T, names ...string) {
+	ctx := context.Background()
+	for _, name := range names {
+		keys, err := redisClient.NewQuery().scanPatternKeys("*" + escapePattern(name) + "*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range keys {
+			if err = redisClient.client.Do(ctx, "del", key).Err(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
 func TestBFRRedis_GetPrimaryKey(t *testing.T) {
 	type args struct {
 		v *RedisTest
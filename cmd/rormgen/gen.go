@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const rormImport = "gogs.buffalo-robot.com/zouhy/rorm"
+
+//生成的代码中可能使用的包
+var packages = []string{"fmt", "strconv", "time", "rorm"}
+
+var packageUses = map[string]*regexp.Regexp{}
+
+func init() {
+	for _, name := range packages {
+		packageUses[name] = regexp.MustCompile(`(^|[^.\w])` + name + `\.`)
+	}
+}
+
+//generate 生成names中结构体的方法 names为空时生成包中所有带有redis标签的结构体
+func generate(pkg *goPackage, names []string) ([]byte, error) {
+	if len(names) == 0 {
+		for _, name := range pkg.order {
+			if pkg.hasRedisTag(pkg.structs[name], map[*ast.StructType]bool{}) {
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no struct with redis tags found in package %s", pkg.name)
+	}
+
+	g := &generator{imports: map[string]bool{}}
+	for _, name := range names {
+		m, err := pkg.parseModel(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		g.model(m)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by rormgen. DO NOT EDIT.\n\npackage %s\n\n", pkg.name)
+	buf.WriteString("import (\n")
+	for _, name := range packages[:3] {
+		if g.imports[name] {
+			fmt.Fprintf(&buf, "\t%q\n", name)
+		}
+	}
+	if g.imports["rorm"] {
+		fmt.Fprintf(&buf, "\n\t%q\n", rormImport)
+	}
+	buf.WriteString(")\n")
+	buf.Write(g.buf.Bytes())
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+//use 记录表达式中使用的包 表达式中不包含用户定义的字符串
+func (g *generator) use(expr string) string {
+	for name, re := range packageUses {
+		if re.MatchString(expr) {
+			g.imports[name] = true
+		}
+	}
+	return expr
+}
+
+func (g *generator) model(m *model) {
+	//名称可能通过RegisterModelName注册 由rorm得到
+	parts := []string{g.use("rorm.ModelName(m)")}
+	for _, field := range m.primaries {
+		parts = append(parts, strconv.Quote("/"+field.stored+"/"), g.use(keyExpr(field, "m."+field.path)))
+	}
+	g.printf("\n//RedisKey 得到%s的key\n", m.name)
+	g.printf("func (m *%s) RedisKey() string {\n\treturn %s\n}\n", m.name, strings.Join(parts, " + "))
+
+	g.printf("\n//RedisHash 得到%s写入HMAP的字段\n", m.name)
+	g.printf("func (m *%s) RedisHash() map[string]interface{} {\n", m.name)
+	g.printf("\th := make(map[string]interface{}, %d)\n", len(m.fields))
+	for _, field := range m.fields {
+		g.encodeField(field)
+	}
+	g.printf("\treturn h\n}\n")
+
+	g.printf("\n//FromRedisHash 将HMAP中的数据解析到%s中\n", m.name)
+	g.printf("func (m *%s) FromRedisHash(data map[string]string) error {\n", m.name)
+	for _, field := range m.fields {
+		g.decodeField(field)
+	}
+	g.printf("\treturn nil\n}\n")
+}
+
+//keyExpr 与fmt.Sprintf("%v")相同的主键值 字符串使用与默认KeyNamer相同的转义
+func keyExpr(f *modelField, expr string) string {
+	if f.ptr {
+		return "rorm.EscapeKeyValue(fmt.Sprint(" + expr + "))"
+	}
+	switch f.kind {
+	case kindString:
+		if f.goType != "string" {
+			expr = "string(" + expr + ")"
+		}
+		return "rorm.EscapeKeyValue(" + expr + ")"
+	case kindBool:
+		return "strconv.FormatBool(" + expr + ")"
+	case kindInt:
+		return "strconv.FormatInt(int64(" + expr + "), 10)"
+	case kindUint:
+		return "strconv.FormatUint(uint64(" + expr + "), 10)"
+	case kindFloat:
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'g', -1, %d)", expr, f.bits)
+	}
+	return "rorm.EscapeKeyValue(fmt.Sprint(" + expr + "))"
+}
+
+//encodeExpr 字段值存储在redis中的字符串 kindOther直接返回值 由rorm使用类型对应的Codec转换
+func encodeExpr(f *modelField, expr string) string {
+	switch f.kind {
+	case kindString:
+		return expr
+	case kindBool:
+		return "rorm.FormatBool(" + expr + ")"
+	case kindInt, kindDuration:
+		return "strconv.FormatInt(int64(" + expr + "), 10)"
+	case kindUint:
+		return "strconv.FormatUint(uint64(" + expr + "), 10)"
+	case kindFloat:
+		return fmt.Sprintf("strconv.FormatFloat(float64(%s), 'f', -1, %d)", expr, f.bits)
+	case kindTime:
+		if f.tags["time"] == "unix" {
+			return "rorm.FormatUnixTime(" + expr + ")"
+		}
+		if strings.HasPrefix(expr, "*") {
+			expr = "(" + expr + ")"
+		}
+		return expr + ".Format(time.RFC3339Nano)"
+	}
+	return expr
+}
+
+//zeroExpr 判断字段是否为零值的表达式 用于omitempty
+func zeroExpr(f *modelField, expr string) string {
+	if f.ptr {
+		return expr + " == nil"
+	}
+	switch f.kind {
+	case kindString:
+		return expr + ` == ""`
+	case kindBool:
+		return "!" + expr
+	case kindInt, kindUint, kindFloat, kindDuration:
+		return expr + " == 0"
+	case kindTime:
+		return expr + ".IsZero()"
+	}
+	return "rorm.IsZeroValue(" + expr + ")"
+}
+
+func (g *generator) encodeField(f *modelField) {
+	expr := "m." + f.path
+	name := strconv.Quote(f.stored)
+	_, omitempty := f.tags["omitempty"]
+	switch {
+	case f.ptr && f.kind != kindOther:
+		g.printf("\tif %s == nil {\n\t\th[%s] = nil\n\t} else {\n\t\th[%s] = %s\n\t}\n", expr, name, name, g.use(encodeExpr(f, "*"+expr)))
+	case omitempty:
+		g.printf("\tif %s {\n\t\th[%s] = nil\n\t} else {\n\t\th[%s] = %s\n\t}\n", g.use(zeroExpr(f, expr)), name, name, g.use(encodeExpr(f, expr)))
+	default:
+		g.printf("\th[%s] = %s\n", name, g.use(encodeExpr(f, expr)))
+	}
+}
+
+func (g *generator) decodeField(f *modelField) {
+	expr := "m." + f.path
+	name := strconv.Quote(f.stored)
+	def, hasDefault := f.tags["default"]
+	switch {
+	case hasDefault:
+		g.printf("\t{\n\t\tvalue, ok := data[%s]\n\t\tif !ok {\n\t\t\tvalue = %s\n\t\t}\n", name, strconv.Quote(def))
+		g.decodeValue(f, expr)
+		g.printf("\t}\n")
+	case f.ptr:
+		g.printf("\tif value, ok := data[%s]; ok {\n", name)
+		g.decodeValue(f, expr)
+		//没有存储的指针字段为nil
+		g.printf("\t} else {\n\t\t%s = nil\n\t}\n", expr)
+	default:
+		g.printf("\tif value, ok := data[%s]; ok {\n", name)
+		g.decodeValue(f, expr)
+		g.printf("\t}\n")
+	}
+}
+
+//decodeValue 将变量value解析到expr中
+func (g *generator) decodeValue(f *modelField, expr string) {
+	var parse, convert string
+	switch f.kind {
+	case kindString:
+		convert = "value"
+		if f.goType != "string" {
+			convert = f.goType + "(value)"
+		}
+	case kindBool:
+		convert = "rorm.ParseBool(value)"
+	case kindInt:
+		parse = fmt.Sprintf("strconv.ParseInt(value, 10, %d)", f.bits)
+		convert = f.goType + "(v)"
+	case kindUint:
+		parse = fmt.Sprintf("strconv.ParseUint(value, 10, %d)", f.bits)
+		convert = f.goType + "(v)"
+	case kindFloat:
+		parse = fmt.Sprintf("strconv.ParseFloat(value, %d)", f.bits)
+		convert = f.goType + "(v)"
+	case kindTime:
+		parse = "rorm.ParseTime(value)"
+		convert = "v"
+	case kindDuration:
+		parse = "rorm.ParseDuration(value)"
+		convert = "v"
+	default:
+		g.use("rorm.DecodeValue fmt.Errorf")
+		g.printf("\t\tif err := rorm.DecodeValue(value, &%s); err != nil {\n", expr)
+		g.printf("\t\t\treturn fmt.Errorf(\"decode field %%s: %%w\", %s, err)\n\t\t}\n", strconv.Quote(f.stored))
+		return
+	}
+	g.use(convert)
+	if parse != "" {
+		g.use(parse + " fmt.Errorf")
+		g.printf("\t\tv, err := %s\n", parse)
+		g.printf("\t\tif err != nil {\n\t\t\treturn fmt.Errorf(\"decode field %%s: %%w\", %s, err)\n\t\t}\n", strconv.Quote(f.stored))
+	}
+	if f.ptr {
+		g.printf("\t\tx := %s\n\t\t%s = &x\n", convert, expr)
+	} else {
+		g.printf("\t\t%s = %s\n", expr, convert)
+	}
+}
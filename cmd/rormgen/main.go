@@ -0,0 +1,121 @@
+//rormgen 为带有redis标签的model生成RedisHash FromRedisHash RedisKey方法
+//rorm检测到这些方法后Create Find不再通过反射处理字段 标签错误在生成时报告
+//
+//用法 在model所在的包中添加
+//  //go:generate rormgen -type User,Order
+//不指定-type时为包中所有带有redis标签的结构体生成
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; default all structs with redis tags")
+	output    = flag.String("output", "", "output file name; default <dir>/rorm_gen.go")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("rormgen: ")
+	flag.Parse()
+
+	dir := "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	outputName := *output
+	if outputName == "" {
+		outputName = filepath.Join(dir, "rorm_gen.go")
+	}
+
+	pkg, err := parsePackage(dir, outputName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+	src, err := generate(pkg, names)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+//goPackage 解析后的包
+type goPackage struct {
+	name    string
+	structs map[string]*ast.StructType
+	order   []string            //结构体定义的顺序
+	methods map[string][]string //类型名对应的方法名
+}
+
+//parsePackage 解析dir中除测试文件与输出文件以外的Go文件
+func parsePackage(dir string, outputName string) (*goPackage, error) {
+	outputAbs, _ := filepath.Abs(outputName)
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		if strings.HasSuffix(info.Name(), "_test.go") {
+			return false
+		}
+		abs, _ := filepath.Abs(filepath.Join(dir, info.Name()))
+		return abs != outputAbs
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	pkg := &goPackage{structs: map[string]*ast.StructType{}, methods: map[string][]string{}}
+	for name, astPkg := range pkgs {
+		pkg.name = name
+		files := make([]string, 0, len(astPkg.Files))
+		for file := range astPkg.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			ast.Inspect(astPkg.Files[file], func(node ast.Node) bool {
+				if fn, ok := node.(*ast.FuncDecl); ok {
+					if fn.Recv != nil && len(fn.Recv.List) == 1 {
+						recv := fn.Recv.List[0].Type
+						if star, ok := recv.(*ast.StarExpr); ok {
+							recv = star.X
+						}
+						if ident, ok := recv.(*ast.Ident); ok {
+							pkg.methods[ident.Name] = append(pkg.methods[ident.Name], fn.Name.Name)
+						}
+					}
+					return false
+				}
+				spec, ok := node.(*ast.TypeSpec)
+				if !ok {
+					return true
+				}
+				if st, ok := spec.Type.(*ast.StructType); ok {
+					pkg.structs[spec.Name.Name] = st
+					pkg.order = append(pkg.order, spec.Name.Name)
+				}
+				return false
+			})
+		}
+	}
+	return pkg, nil
+}
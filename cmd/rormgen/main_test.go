@@ -0,0 +1,141 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const modelSource = `package models
+
+import "time"
+
+type Level int
+
+type Base struct {
+	ID      string ` + "`redis:\"primary\"`" + `
+	Version int64  ` + "`redis:\"version\"`" + `
+}
+
+//Point 实现了TextMarshaler 匿名时不提升
+type Point struct {
+	X, Y int
+}
+
+func (p Point) MarshalText() ([]byte, error) { return nil, nil }
+
+func (p *Point) UnmarshalText(data []byte) error { return nil }
+
+type User struct {
+	Base
+	Point
+	Shard  uint8         ` + "`redis:\"primary\"`" + `
+	Name   string        ` + "`redis:\"name:n;index\"`" + `
+	Age    *int          ` + "`redis:\"omitempty\"`" + `
+	Score  float32       ` + "`redis:\"default:1.5\"`" + `
+	Active bool
+	Level  Level
+	Born   time.Time     ` + "`redis:\"time:unix\"`" + `
+	Seen   *time.Time
+	TTL    time.Duration
+	Tags   []string
+	Skip   string        ` + "`redis:\"-\"`" + `
+}
+
+type Plain struct {
+	A string
+}
+`
+
+func writePackage(t *testing.T, source string) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "models.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writePackage(t, modelSource)
+	output := filepath.Join(dir, "rorm_gen.go")
+	//旧的输出文件不参与解析
+	assert.Nil(t, ioutil.WriteFile(output, []byte("package models\n\ntype Old struct{ A int `redis:\"primary\"` }\n"), 0644))
+
+	pkg, err := parsePackage(dir, output)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Base", "Point", "User", "Plain"}, pkg.order)
+
+	src, err := generate(pkg, nil)
+	assert.Nil(t, err)
+	code := string(src)
+	_, err = parser.ParseFile(token.NewFileSet(), output, src, 0)
+	assert.Nil(t, err)
+
+	for _, want := range []string{
+		"// Code generated by rormgen. DO NOT EDIT.",
+		`"gogs.buffalo-robot.com/zouhy/rorm"`,
+		`func (m *Base) RedisKey() string`,
+		`return rorm.ModelName(m) + "/ID/" + rorm.EscapeKeyValue(m.Base.ID) + "/Shard/" + strconv.FormatUint(uint64(m.Shard), 10)`,
+		`h["n"] = m.Name`,
+		`h["Version"] = strconv.FormatInt(int64(m.Base.Version), 10)`,
+		`h["Seen"] = (*m.Seen).Format(time.RFC3339Nano)`,
+		`h["Born"] = rorm.FormatUnixTime(m.Born)`,
+		`h["Level"] = m.Level`,
+		`h["Point"] = m.Point`,
+		`if err := rorm.DecodeValue(value, &m.Tags); err != nil {`,
+		`value = "1.5"`,
+		`m.Age = nil`,
+	} {
+		assert.Contains(t, code, want)
+	}
+	for _, unwanted := range []string{"Skip", "Plain", "Old", "Point.X"} {
+		assert.NotContains(t, code, unwanted)
+	}
+
+	//只生成指定的结构体 没有使用的包不导入
+	src, err = generate(pkg, []string{"Base"})
+	assert.Nil(t, err)
+	code = string(src)
+	assert.Contains(t, code, "func (m *Base) FromRedisHash")
+	assert.NotContains(t, code, "User")
+	assert.NotContains(t, code, `"time"`)
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields string
+		want   string
+	}{
+		{"no primary", "A string", "no redis:\"primary\" field"},
+		{"unknown option", "A string `redis:\"primary;indx\"`", `unknown redis tag option "indx"`},
+		{"unsupported option", "A string `redis:\"primary\"`\nB string `redis:\"compress:gzip\"`", `"compress" is not supported`},
+		{"bad time format", "A string `redis:\"primary\"`\nB string `redis:\"time:unix\"`", "time:unix can only be used on time.Time fields"},
+		{"bad default", "A string `redis:\"primary\"`\nB int8 `redis:\"default:300\"`", `invalid default "300"`},
+		{"bad version", "A string `redis:\"primary\"`\nB string `redis:\"version\"`", "version field must be an integer"},
+		{"bad auto", "A int `redis:\"primary;auto:uuid\"`", "auto:uuid field must be a string"},
+		{"auto not primary", "A string `redis:\"primary\"`\nB int `redis:\"auto:incr\"`", "auto can only be used on primary fields"},
+		{"duplicate stored name", "A string `redis:\"primary\"`\nB string `redis:\"name:A\"`", `both stored as "A"`},
+		{"unexported field", "A string `redis:\"primary\"`\nb string", "unexported field"},
+		{"embedded pointer", "*Inner\nA string `redis:\"primary\"`", "embedded field *Inner is not supported"},
+		{"ambiguous field", "Inner\nOther\nA string `redis:\"primary\"`", "ambiguous promoted fields Inner.B and Other.B"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := "package models\n\ntype Inner struct {\n\tB string\n}\n\ntype Other struct {\n\tB string\n}\n\n" +
+				"type Model struct {\n" + tt.fields + "\n}\n"
+			dir := writePackage(t, source)
+			pkg, err := parsePackage(dir, filepath.Join(dir, "rorm_gen.go"))
+			assert.Nil(t, err)
+			_, err = generate(pkg, []string{"Model"})
+			if assert.NotNil(t, err) {
+				assert.True(t, strings.Contains(err.Error(), tt.want), err.Error())
+			}
+		})
+	}
+}
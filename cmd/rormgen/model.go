@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//fieldKind 生成代码时字段值的转换方式
+type fieldKind int
+
+const (
+	kindOther fieldKind = iota //使用rorm中类型对应的Codec
+	kindString
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindTime
+	kindDuration
+)
+
+var basicKinds = map[string]struct {
+	kind fieldKind
+	bits int
+}{
+	"string":  {kindString, 0},
+	"bool":    {kindBool, 0},
+	"int":     {kindInt, 0},
+	"int8":    {kindInt, 8},
+	"int16":   {kindInt, 16},
+	"int32":   {kindInt, 32},
+	"int64":   {kindInt, 64},
+	"uint":    {kindUint, 0},
+	"uint8":   {kindUint, 8},
+	"uint16":  {kindUint, 16},
+	"uint32":  {kindUint, 32},
+	"uint64":  {kindUint, 64},
+	"float32": {kindFloat, 32},
+	"float64": {kindFloat, 64},
+	"byte":    {kindUint, 8},
+	"rune":    {kindInt, 32},
+}
+
+//knownOptions redis标签中的选项 值为false的选项rormgen不支持
+var knownOptions = map[string]bool{
+	"primary":     true,
+	"index":       true,
+	"version":     true,
+	"name":        true,
+	"omitempty":   true,
+	"default":     true,
+	"time":        true,
+	"auto":        true,
+	"inline":      false,
+	"foreignKey":  false,
+	"compress":    false,
+	"compressmin": false,
+	"encrypt":     false,
+}
+
+//modelField model中需要存储的字段 匿名结构体中的字段已经提升
+type modelField struct {
+	path   string //访问字段的表达式 例如 BaseModel.ID
+	name   string //Go中的字段名
+	stored string //存储在HMAP中的字段名
+	tags   map[string]string
+	kind   fieldKind
+	bits   int
+	ptr    bool
+	goType string //指针字段为指向的类型
+	depth  int
+}
+
+//model 需要生成方法的结构体
+type model struct {
+	name      string
+	fields    []*modelField
+	primaries []*modelField
+}
+
+//hasRedisTag 结构体或其匿名结构体中是否有redis标签
+func (pkg *goPackage) hasRedisTag(st *ast.StructType, visited map[*ast.StructType]bool) bool {
+	if visited[st] {
+		return false
+	}
+	visited[st] = true
+	for _, field := range st.Fields.List {
+		if _, ok := lookupTag(field, "redis"); ok {
+			return true
+		}
+		if ident, ok := field.Type.(*ast.Ident); ok && len(field.Names) == 0 {
+			if embedded, ok := pkg.structs[ident.Name]; ok && !pkg.hasCodecMethods(ident.Name) && pkg.hasRedisTag(embedded, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//parseModel 解析结构体name的字段并检查redis标签
+func (pkg *goPackage) parseModel(name string) (*model, error) {
+	st, ok := pkg.structs[name]
+	if !ok {
+		return nil, fmt.Errorf("struct type %s not found", name)
+	}
+	m := &model{name: name}
+	var fields []*modelField
+	if err := pkg.collectFields(name, st, "", 0, map[*ast.StructType]bool{}, &fields); err != nil {
+		return nil, err
+	}
+
+	//与encoding/json相同 外层的字段优先 同一层中同名的字段报错
+	depths := map[string]int{}
+	for _, field := range fields {
+		if depth, ok := depths[field.name]; !ok || field.depth < depth {
+			depths[field.name] = field.depth
+		}
+	}
+	promoted := map[string]string{}
+	stored := map[string]string{}
+	for _, field := range fields {
+		if depths[field.name] != field.depth {
+			continue
+		}
+		if other, ok := promoted[field.name]; ok {
+			return nil, fmt.Errorf("%s: ambiguous promoted fields %s and %s", name, other, field.path)
+		}
+		promoted[field.name] = field.path
+		if other, ok := stored[field.stored]; ok {
+			return nil, fmt.Errorf("%s: fields %s and %s are both stored as %q", name, other, field.path, field.stored)
+		}
+		stored[field.stored] = field.path
+		m.fields = append(m.fields, field)
+		if _, ok := field.tags["primary"]; ok {
+			m.primaries = append(m.primaries, field)
+		}
+	}
+	if len(m.primaries) == 0 {
+		return nil, fmt.Errorf(`%s: no redis:"primary" field`, name)
+	}
+	return m, nil
+}
+
+//codecMethods rorm中用于编码与解码的接口方法
+var codecMethods = map[string]bool{
+	"RedisValue": true, "RedisScan": true,
+	"MarshalText": true, "UnmarshalText": true,
+	"MarshalBinary": true, "UnmarshalBinary": true,
+	"MarshalJSON": true, "UnmarshalJSON": true,
+	"Value": true, "Scan": true,
+}
+
+//hasCodecMethods 类型是否实现了rorm编码接口中的方法 通过RegisterCodec注册的Codec无法在生成时判断
+func (pkg *goPackage) hasCodecMethods(name string) bool {
+	for _, method := range pkg.methods[name] {
+		if codecMethods[method] {
+			return true
+		}
+	}
+	return false
+}
+
+func (pkg *goPackage) collectFields(model string, st *ast.StructType, prefix string, depth int, visited map[*ast.StructType]bool, fields *[]*modelField) error {
+	if visited[st] {
+		return fmt.Errorf("%s: recursive embedded struct", model)
+	}
+	visited[st] = true
+	defer delete(visited, st)
+
+	for _, field := range st.Fields.List {
+		tag, _ := lookupTag(field, "redis")
+		if tag == "-" {
+			continue
+		}
+
+		if len(field.Names) == 0 {
+			ident, ok := field.Type.(*ast.Ident)
+			embedded, found := pkg.structs[identName(ident)]
+			if !ok || !found {
+				return fmt.Errorf("%s: embedded field %s is not supported, only non-pointer structs of the same package can be embedded", model, types.ExprString(field.Type))
+			}
+			if tag != "" {
+				return fmt.Errorf("%s: embedded field %s can not have redis tag", model, ident.Name)
+			}
+			if pkg.hasCodecMethods(ident.Name) {
+				//与rorm相同 实现了编码接口的匿名结构体不提升 整体作为一个字段编码
+				f := &modelField{path: prefix + ident.Name, name: ident.Name, stored: ident.Name, tags: parseTag(tag), depth: depth}
+				if err := f.setType(field.Type); err != nil {
+					return fmt.Errorf("%s.%s: %v", model, f.path, err)
+				}
+				*fields = append(*fields, f)
+				continue
+			}
+			if err := pkg.collectFields(model, embedded, prefix+ident.Name+".", depth+1, visited, fields); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tags := parseTag(tag)
+		for _, name := range field.Names {
+			path := prefix + name.Name
+			if !name.IsExported() {
+				return fmt.Errorf("%s.%s: unexported field can not be stored", model, path)
+			}
+			f := &modelField{path: path, name: name.Name, stored: name.Name, tags: tags, depth: depth}
+			if err := f.setType(field.Type); err != nil {
+				return fmt.Errorf("%s.%s: %v", model, path, err)
+			}
+			if err := f.checkTags(); err != nil {
+				return fmt.Errorf("%s.%s: %v", model, path, err)
+			}
+			*fields = append(*fields, f)
+		}
+	}
+	return nil
+}
+
+//setType 根据字段类型确定转换方式 只有预定义类型与time.Time time.Duration直接转换
+func (f *modelField) setType(expr ast.Expr) error {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		f.ptr = true
+		expr = star.X
+	}
+	f.goType = types.ExprString(expr)
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if basic, ok := basicKinds[t.Name]; ok {
+			f.kind, f.bits = basic.kind, basic.bits
+		}
+	case *ast.SelectorExpr:
+		switch f.goType {
+		case "time.Time":
+			f.kind = kindTime
+		case "time.Duration":
+			f.kind = kindDuration
+		}
+	case *ast.StructType, *ast.InterfaceType, *ast.FuncType, *ast.ChanType:
+		if !f.ptr && f.goType != "interface{}" {
+			return fmt.Errorf("type %s can not be stored", f.goType)
+		}
+	}
+	return nil
+}
+
+//checkTags 检查redis标签 rorm运行时会忽略的错误在生成时报告
+func (f *modelField) checkTags() error {
+	for option, value := range f.tags {
+		supported, ok := knownOptions[option]
+		if !ok {
+			return fmt.Errorf("unknown redis tag option %q", option)
+		}
+		if !supported {
+			return fmt.Errorf("redis tag option %q is not supported by rormgen", option)
+		}
+		switch option {
+		case "name":
+			if value == "" || strings.Contains(value, ".") {
+				return fmt.Errorf("invalid stored name %q", value)
+			}
+			f.stored = value
+		case "time":
+			if value != "unix" {
+				return fmt.Errorf("invalid time format %q, only unix is supported", value)
+			}
+			if f.kind != kindTime {
+				return fmt.Errorf("time:unix can only be used on time.Time fields")
+			}
+		case "version":
+			if f.ptr || (f.kind != kindInt && f.kind != kindUint) {
+				return fmt.Errorf("version field must be an integer")
+			}
+		case "auto":
+			if err := checkAuto(f, value); err != nil {
+				return err
+			}
+		case "primary", "omitempty":
+			if value != "" {
+				return fmt.Errorf("redis tag option %q does not take a value", option)
+			}
+		}
+	}
+	if value, ok := f.tags["default"]; ok {
+		if err := checkDefault(f, value); err != nil {
+			return fmt.Errorf("invalid default %q: %v", value, err)
+		}
+	}
+	return nil
+}
+
+//checkAuto 检查auto主键的生成方式与字段类型
+func checkAuto(f *modelField, value string) error {
+	if _, ok := f.tags["primary"]; !ok {
+		return fmt.Errorf("auto can only be used on primary fields")
+	}
+	integer := !f.ptr && (f.kind == kindString || f.kind == kindInt || f.kind == kindUint)
+	switch value {
+	case "incr", "snowflake":
+		if !integer {
+			return fmt.Errorf("auto:%s field must be an integer or string", value)
+		}
+	case "uuid", "ulid":
+		if f.ptr || f.kind != kindString {
+			return fmt.Errorf("auto:%s field must be a string", value)
+		}
+	default:
+		return fmt.Errorf("unknown auto primary key %q", value)
+	}
+	return nil
+}
+
+//checkDefault 检查默认值能否被解析
+func checkDefault(f *modelField, value string) (err error) {
+	switch f.kind {
+	case kindInt:
+		_, err = strconv.ParseInt(value, 10, f.bits)
+	case kindUint:
+		_, err = strconv.ParseUint(value, 10, f.bits)
+	case kindFloat:
+		_, err = strconv.ParseFloat(value, f.bits)
+	}
+	return
+}
+
+func identName(ident *ast.Ident) string {
+	if ident == nil {
+		return ""
+	}
+	return ident.Name
+}
+
+func lookupTag(field *ast.Field, key string) (string, bool) {
+	if field.Tag == nil {
+		return "", false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return "", false
+	}
+	return reflect.StructTag(tag).Lookup(key)
+}
+
+//parseTag 与rorm中parseRedisTag相同
+func parseTag(tag string) map[string]string {
+	settings := map[string]string{}
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) == 2 {
+			settings[kv[0]] = kv[1]
+		} else {
+			settings[kv[0]] = ""
+		}
+	}
+	return settings
+}
@@ -0,0 +1,528 @@
+package rorm
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//Codec 负责一种类型与其存储在redis中的字符串之间的相互转换
+//通过RegisterCodec注册后 Create Update Updates Find Pluck ConvertStructToMap以及索引都会使用该Codec
+type Codec interface {
+	//Encode 将v转换为存储在redis中的字符串
+	Encode(v reflect.Value) (string, error)
+	//Decode 将data解析到v中 v可以被设置
+	Decode(data string, v reflect.Value) error
+}
+
+var (
+	codecs        sync.Map
+	builtinCodecs sync.Map
+
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+
+	//errSkipField 该字段无法存储 直接跳过
+	errSkipField = errors.New("field can not be stored")
+)
+
+//RegisterCodec 注册typ类型的Codec 覆盖默认的转换方式
+//例如 rorm.RegisterCodec(reflect.TypeOf(decimal.Decimal{}), decimalCodec{})
+func RegisterCodec(typ reflect.Type, codec Codec) {
+	codecs.Store(typ, codec)
+	fieldCodecs.Range(func(key, value interface{}) bool {
+		fieldCodecs.Delete(key)
+		return true
+	})
+	resetSchemas()
+}
+
+//lookupCodec 查找typ类型使用的Codec 优先级从高到低为
+//  1. RegisterCodec注册的Codec
+//  2. 指针 使用指向的类型的Codec
+//  3. time.Time time.Duration
+//  4. 类型或其指针实现的接口 按以下顺序使用第一对写入与读取都实现的接口
+//     Valuer/Scanner encoding.TextMarshaler/TextUnmarshaler encoding.BinaryMarshaler/BinaryUnmarshaler
+//     json.Marshaler/Unmarshaler driver.Valuer/sql.Scanner
+//     没有成对实现时见lookupMarshalerCodec
+//  5. 基础类型 Slice Array Map存储为JSON 其他无法存储的类型直接跳过
+func lookupCodec(typ reflect.Type) Codec {
+	if codec, ok := codecs.Load(typ); ok {
+		return codec.(Codec)
+	}
+	if codec, ok := builtinCodecs.Load(typ); ok {
+		return codec.(Codec)
+	}
+	codec := builtinCodec(typ)
+	builtinCodecs.Store(typ, codec)
+	return codec
+}
+
+//builtinCodec 没有注册Codec时typ使用的转换方式 结果缓存在builtinCodecs中
+func builtinCodec(typ reflect.Type) Codec {
+	switch typ {
+	case timeType:
+		return timeCodec{}
+	case durationType:
+		return durationCodec{}
+	}
+	if typ.Kind() == reflect.Ptr {
+		return ptrCodec{}
+	}
+	if codec, ok := lookupMarshalerCodec(typ); ok {
+		return codec
+	}
+	return kindCodec(typ)
+}
+
+//kindCodec 根据基础类型得到Codec
+func kindCodec(typ reflect.Type) Codec {
+	switch typ.Kind() {
+	case reflect.String:
+		return stringCodec{}
+	case reflect.Bool:
+		return boolCodec{}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return intCodec{}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return uintCodec{}
+	case reflect.Float32, reflect.Float64:
+		return floatCodec{}
+	case reflect.Slice, reflect.Array, reflect.Map: //对于Slice Array Map三种类型 直接存储其对应的JSON
+		return jsonCodec{}
+	case reflect.Interface:
+		return anyCodec{}
+	default:
+		return skipCodec{}
+	}
+}
+
+//fieldCodecKey 字段使用的Codec只与字段标签和值的类型有关
+type fieldCodecKey struct {
+	tag reflect.StructTag
+	typ reflect.Type
+}
+
+//fieldCodecs 缓存fieldCodec的结果 RegisterCodec时清除
+var fieldCodecs sync.Map
+
+//fieldCodec 得到结构体字段sf使用的Codec typ为实际写入或读取的值的类型
+//编码后的值再按字段标签压缩 例如 redis:"compress:gzip"
+func fieldCodec(sf reflect.StructField, typ reflect.Type) Codec {
+	key := fieldCodecKey{tag: sf.Tag, typ: typ}
+	if codec, ok := fieldCodecs.Load(key); ok {
+		return codec.(Codec)
+	}
+	codec := newCompressCodec(sf, valueCodec(sf, typ))
+	fieldCodecs.Store(key, codec)
+	return codec
+}
+
+//valueCodec 注册的Codec优先 其次是字段标签指定的转换方式 例如 redis:"time:unix"
+func valueCodec(sf reflect.StructField, typ reflect.Type) Codec {
+	if _, ok := codecs.Load(typ); ok {
+		return lookupCodec(typ)
+	}
+	if parseRedisTag(sf.Tag.Get("redis"))["time"] == "unix" {
+		switch typ {
+		case timeType:
+			return unixTimeCodec{}
+		case reflect.PtrTo(timeType):
+			return ptrCodec{elem: unixTimeCodec{}}
+		}
+	}
+	return lookupCodec(typ)
+}
+
+//encodeValue 使用v类型对应的Codec转换v
+func encodeValue(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "", errSkipField
+	}
+	return lookupCodec(v.Type()).Encode(v)
+}
+
+//decodeValue 使用v类型对应的Codec将data解析到v中
+func decodeValue(data string, v reflect.Value) error {
+	return lookupCodec(v.Type()).Decode(data, v)
+}
+
+type stringCodec struct{}
+
+func (stringCodec) Encode(v reflect.Value) (string, error) {
+	return v.String(), nil
+}
+
+func (stringCodec) Decode(data string, v reflect.Value) error {
+	v.SetString(data)
+	return nil
+}
+
+//boolCodec bool存储为1/0
+type boolCodec struct{}
+
+func (boolCodec) Encode(v reflect.Value) (string, error) {
+	if v.Bool() {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func (boolCodec) Decode(data string, v reflect.Value) error {
+	v.SetBool(data == "1" || data == "true")
+	return nil
+}
+
+type intCodec struct{}
+
+func (intCodec) Encode(v reflect.Value) (string, error) {
+	return strconv.FormatInt(v.Int(), 10), nil
+}
+
+func (intCodec) Decode(data string, v reflect.Value) error {
+	value, err := strconv.ParseInt(data, 10, v.Type().Bits())
+	if err != nil {
+		return err
+	}
+	v.SetInt(value)
+	return nil
+}
+
+type uintCodec struct{}
+
+func (uintCodec) Encode(v reflect.Value) (string, error) {
+	return strconv.FormatUint(v.Uint(), 10), nil
+}
+
+func (uintCodec) Decode(data string, v reflect.Value) error {
+	value, err := strconv.ParseUint(data, 10, v.Type().Bits())
+	if err != nil {
+		return err
+	}
+	v.SetUint(value)
+	return nil
+}
+
+type floatCodec struct{}
+
+func (floatCodec) Encode(v reflect.Value) (string, error) {
+	return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+}
+
+func (floatCodec) Decode(data string, v reflect.Value) error {
+	value, err := strconv.ParseFloat(data, v.Type().Bits())
+	if err != nil {
+		return err
+	}
+	v.SetFloat(value)
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v reflect.Value) (string, error) {
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (jsonCodec) Decode(data string, v reflect.Value) error {
+	ptr := reflect.New(v.Type())
+	if err := json.Unmarshal([]byte(data), ptr.Interface()); err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+//ptrCodec 使用指针指向的类型的Codec nil指针不存储
+//elem为空时根据指向的类型查找Codec
+type ptrCodec struct {
+	elem Codec
+}
+
+func (c ptrCodec) elemCodec(typ reflect.Type) Codec {
+	if c.elem != nil {
+		return c.elem
+	}
+	return lookupCodec(typ.Elem())
+}
+
+func (c ptrCodec) Encode(v reflect.Value) (string, error) {
+	if v.IsNil() {
+		return "", errSkipField
+	}
+	return c.elemCodec(v.Type()).Encode(v.Elem())
+}
+
+func (c ptrCodec) Decode(data string, v reflect.Value) error {
+	ptr := reflect.New(v.Type().Elem())
+	if err := c.elemCodec(v.Type()).Decode(data, ptr.Elem()); err != nil {
+		return err
+	}
+	v.Set(ptr)
+	return nil
+}
+
+//timeCodec time.Time默认存储为RFC3339Nano格式
+//读取时同样接受unix纳秒 修改redis:"time:unix"标签后已存储的数据仍然可以读取
+type timeCodec struct{}
+
+func (timeCodec) Encode(v reflect.Value) (string, error) {
+	return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+}
+
+func (timeCodec) Decode(data string, v reflect.Value) error {
+	t, err := parseTime(data)
+	if err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+//unixTimeCodec redis:"time:unix"标签的time.Time存储为unix纳秒 零值存储为""
+type unixTimeCodec struct{}
+
+func (unixTimeCodec) Encode(v reflect.Value) (string, error) {
+	t := v.Interface().(time.Time)
+	if t.IsZero() {
+		return "", nil
+	}
+	return strconv.FormatInt(t.UnixNano(), 10), nil
+}
+
+func (unixTimeCodec) Decode(data string, v reflect.Value) error {
+	return timeCodec{}.Decode(data, v)
+}
+
+func parseTime(data string) (time.Time, error) {
+	if data == "" {
+		return time.Time{}, nil
+	}
+	if nanos, err := strconv.ParseInt(data, 10, 64); err == nil {
+		return time.Unix(0, nanos), nil
+	}
+	return time.Parse(time.RFC3339Nano, data)
+}
+
+//durationCodec time.Duration存储为纳秒 读取时同样接受time.ParseDuration的格式 例如 1m30s
+type durationCodec struct{}
+
+func (durationCodec) Encode(v reflect.Value) (string, error) {
+	return strconv.FormatInt(v.Int(), 10), nil
+}
+
+func (durationCodec) Decode(data string, v reflect.Value) error {
+	if nanos, err := strconv.ParseInt(data, 10, 64); err == nil {
+		v.SetInt(nanos)
+		return nil
+	}
+	d, err := time.ParseDuration(data)
+	if err != nil {
+		return err
+	}
+	v.SetInt(int64(d))
+	return nil
+}
+
+//interfaceEncoder 类型实现了typ接口时 通过encode写入
+type interfaceEncoder struct {
+	typ    reflect.Type
+	encode func(v interface{}) (string, error)
+}
+
+//interfaceDecoder 类型的指针实现了typ接口时 通过decode读取
+type interfaceDecoder struct {
+	typ    reflect.Type
+	decode func(v interface{}, data string) error
+}
+
+//encoders 写入时依次检查的接口 与decoders中相同位置的接口成对使用
+var encoders = []interfaceEncoder{
+	{reflect.TypeOf((*Valuer)(nil)).Elem(), func(v interface{}) (string, error) {
+		return v.(Valuer).RedisValue(), nil
+	}},
+	{reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(), func(v interface{}) (string, error) {
+		data, err := v.(encoding.TextMarshaler).MarshalText()
+		return string(data), err
+	}},
+	{reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem(), func(v interface{}) (string, error) {
+		data, err := v.(encoding.BinaryMarshaler).MarshalBinary()
+		return string(data), err
+	}},
+	{reflect.TypeOf((*json.Marshaler)(nil)).Elem(), func(v interface{}) (string, error) {
+		data, err := v.(json.Marshaler).MarshalJSON()
+		return string(data), err
+	}},
+	{reflect.TypeOf((*driver.Valuer)(nil)).Elem(), func(v interface{}) (string, error) {
+		value, err := v.(driver.Valuer).Value()
+		if err != nil {
+			return "", err
+		}
+		return driverValueString(value)
+	}},
+}
+
+//driverValueString 转换driver.Valuer返回的值 格式与对应基础类型的Codec一致 nil不存储
+func driverValueString(value driver.Value) (string, error) {
+	switch data := value.(type) {
+	case nil:
+		return "", errSkipField
+	case int64:
+		return strconv.FormatInt(data, 10), nil
+	case float64:
+		return strconv.FormatFloat(data, 'f', -1, 64), nil
+	case bool:
+		if data {
+			return "1", nil
+		}
+		return "0", nil
+	case []byte:
+		return string(data), nil
+	case string:
+		return data, nil
+	case time.Time:
+		return data.Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("unsupported driver.Value type %T", value)
+	}
+}
+
+//decoders 读取时依次检查的接口 与encoders中相同位置的接口成对使用
+var decoders = []interfaceDecoder{
+	{reflect.TypeOf((*Scanner)(nil)).Elem(), func(v interface{}, data string) error {
+		return v.(Scanner).RedisScan([]byte(data))
+	}},
+	{reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem(), func(v interface{}, data string) error {
+		return v.(encoding.TextUnmarshaler).UnmarshalText([]byte(data))
+	}},
+	{reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem(), func(v interface{}, data string) error {
+		return v.(encoding.BinaryUnmarshaler).UnmarshalBinary([]byte(data))
+	}},
+	{reflect.TypeOf((*json.Unmarshaler)(nil)).Elem(), func(v interface{}, data string) error {
+		return v.(json.Unmarshaler).UnmarshalJSON([]byte(data))
+	}},
+	{reflect.TypeOf((*sql.Scanner)(nil)).Elem(), func(v interface{}, data string) error {
+		return v.(sql.Scanner).Scan([]byte(data))
+	}},
+}
+
+//lookupMarshalerCodec typ或其指针实现了encoders decoders中的接口时 得到使用这些接口的Codec
+//优先使用第一对写入与读取都实现的接口 保证读取的格式与写入一致
+//只实现了写入或只实现了读取的接口时 另一个方向使用基础类型的Codec
+//两个方向都有实现但不成对时 例如只有driver.Valuer与TextUnmarshaler 编码与解码都返回错误
+func lookupMarshalerCodec(typ reflect.Type) (Codec, bool) {
+	ptrTyp := reflect.PtrTo(typ)
+	codec := marshalerCodec{fallback: kindCodec(typ)}
+	for i := range encoders {
+		if (typ.Implements(encoders[i].typ) || ptrTyp.Implements(encoders[i].typ)) && ptrTyp.Implements(decoders[i].typ) {
+			codec.encoder, codec.decoder = &encoders[i], &decoders[i]
+			return codec, true
+		}
+	}
+	for i := range encoders {
+		if typ.Implements(encoders[i].typ) || ptrTyp.Implements(encoders[i].typ) {
+			codec.encoder = &encoders[i]
+			break
+		}
+	}
+	for i := range decoders {
+		if ptrTyp.Implements(decoders[i].typ) {
+			codec.decoder = &decoders[i]
+			break
+		}
+	}
+	if codec.encoder != nil && codec.decoder != nil {
+		return mismatchedCodec{typ: typ, encoder: codec.encoder.typ, decoder: codec.decoder.typ}, true
+	}
+	return codec, codec.encoder != nil || codec.decoder != nil
+}
+
+//mismatchedCodec 写入与读取的接口不成对的类型 读写的格式可能不一致 因此都返回错误
+type mismatchedCodec struct {
+	typ, encoder, decoder reflect.Type
+}
+
+func (c mismatchedCodec) err() error {
+	return fmt.Errorf("%s implements %s and %s which are not a pair, register a Codec for it", c.typ, c.encoder, c.decoder)
+}
+
+func (c mismatchedCodec) Encode(v reflect.Value) (string, error) {
+	return "", c.err()
+}
+
+func (c mismatchedCodec) Decode(data string, v reflect.Value) error {
+	return c.err()
+}
+
+//marshalerCodec 使用类型实现的接口转换
+type marshalerCodec struct {
+	encoder  *interfaceEncoder
+	decoder  *interfaceDecoder
+	fallback Codec
+}
+
+func (c marshalerCodec) Encode(v reflect.Value) (string, error) {
+	if c.encoder == nil {
+		return c.fallback.Encode(v)
+	}
+	if v.Type().Implements(c.encoder.typ) {
+		return c.encoder.encode(v.Interface())
+	}
+	//方法为指针接收时 复制到新的指针中调用
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return c.encoder.encode(ptr.Interface())
+}
+
+func (c marshalerCodec) Decode(data string, v reflect.Value) error {
+	if c.decoder == nil {
+		return c.fallback.Decode(data, v)
+	}
+	ptr := reflect.New(v.Type())
+	if err := c.decoder.decode(ptr.Interface(), data); err != nil {
+		return err
+	}
+	v.Set(ptr.Elem())
+	return nil
+}
+
+//anyCodec interface{}类型的字段 使用其实际值的Codec 读取时保存为string
+type anyCodec struct{}
+
+func (anyCodec) Encode(v reflect.Value) (string, error) {
+	if v.IsNil() {
+		return "", errSkipField
+	}
+	return encodeValue(v.Elem())
+}
+
+func (anyCodec) Decode(data string, v reflect.Value) error {
+	value := reflect.ValueOf(data)
+	if !value.Type().AssignableTo(v.Type()) {
+		return errSkipField
+	}
+	v.Set(value)
+	return nil
+}
+
+//skipCodec chan func complex以及没有实现Valuer的结构体等类型不存储
+type skipCodec struct{}
+
+func (skipCodec) Encode(v reflect.Value) (string, error) {
+	return "", errSkipField
+}
+
+func (skipCodec) Decode(data string, v reflect.Value) error {
+	return errSkipField
+}
@@ -0,0 +1,287 @@
+package rorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Celsius 通过Codec存储为带单位的字符串
+type Celsius float64
+
+type celsiusCodec struct{}
+
+func (celsiusCodec) Encode(v reflect.Value) (string, error) {
+	data, err := floatCodec{}.Encode(v)
+	return data + "C", err
+}
+
+func (celsiusCodec) Decode(data string, v reflect.Value) error {
+	if !strings.HasSuffix(data, "C") {
+		return errors.New("missing unit")
+	}
+	return floatCodec{}.Decode(strings.TrimSuffix(data, "C"), v)
+}
+
+type CodecTest struct {
+	ID      string `redis:"primary"`
+	Enabled bool
+	Small   int16
+	Ratio   float32
+	PtrBool *bool
+	Temp    Celsius
+}
+
+func TestRegisterCodec(t *testing.T) {
+	ctx := context.Background()
+	RegisterCodec(reflect.TypeOf(Celsius(0)), celsiusCodec{})
+	defer codecs.Delete(reflect.TypeOf(Celsius(0)))
+
+	enabled := true
+	model := &CodecTest{ID: "codec1", Enabled: true, Small: -12, Ratio: 0.1, PtrBool: &enabled, Temp: 36.6}
+	assert.Equal(t, map[string]string{
+		"ID":      "codec1",
+		"Enabled": "1",
+		"Small":   "-12",
+		"Ratio":   "0.1",
+		"PtrBool": "1",
+		"Temp":    "36.6C",
+	}, ConvertStructToMap(model))
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/codec1"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", stored["PtrBool"])
+	assert.Equal(t, "36.6C", stored["Temp"])
+
+	result := &CodecTest{ID: "codec1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	var temp Celsius
+	err = redisClient.NewQuery().PtrData("20C", &temp)
+	assert.Nil(t, err)
+	assert.Equal(t, Celsius(20), temp)
+	assert.NotNil(t, redisClient.NewQuery().PtrData("20", &temp))
+}
+
+type TimeTest struct {
+	ID        string `redis:"primary"`
+	CreatedAt time.Time
+	SeenAt    time.Time  `redis:"time:unix"`
+	UpdatedAt *time.Time `redis:"time:unix"`
+	DeletedAt *time.Time
+	TTL       time.Duration
+}
+
+func TestTimeCodec(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2020, 12, 1, 8, 30, 0, 123456789, time.UTC)
+	updated := created.Add(time.Hour)
+	model := &TimeTest{ID: "time1", CreatedAt: created, SeenAt: created, UpdatedAt: &updated, TTL: 90 * time.Second}
+
+	assert.Equal(t, map[string]string{
+		"ID":        "time1",
+		"CreatedAt": "2020-12-01T08:30:00.123456789Z",
+		"SeenAt":    strconv.FormatInt(created.UnixNano(), 10),
+		"UpdatedAt": strconv.FormatInt(updated.UnixNano(), 10),
+		"TTL":       "90000000000",
+	}, ConvertStructToMap(model))
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	result := &TimeTest{ID: "time1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.True(t, created.Equal(result.CreatedAt))
+	assert.True(t, created.Equal(result.SeenAt))
+	assert.True(t, updated.Equal(*result.UpdatedAt))
+	assert.Nil(t, result.DeletedAt)
+	assert.Equal(t, 90*time.Second, result.TTL)
+
+	deleted := updated.Add(time.Minute)
+	err = redisClient.NewQuery().Update(ctx, &TimeTest{ID: "time1"}, "DeletedAt", &deleted)
+	assert.Nil(t, err)
+	err = redisClient.NewQuery().Updates(ctx, &TimeTest{ID: "time1"}, map[string]interface{}{
+		"SeenAt": deleted,
+		"TTL":    time.Minute,
+	})
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/time1"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.FormatInt(deleted.UnixNano(), 10), stored["SeenAt"])
+	assert.Equal(t, deleted.Format(time.RFC3339Nano), stored["DeletedAt"])
+
+	result = &TimeTest{ID: "time1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.True(t, deleted.Equal(*result.DeletedAt))
+	assert.True(t, deleted.Equal(result.SeenAt))
+	assert.Equal(t, time.Minute, result.TTL)
+}
+
+// MarshalStatus 枚举 通过TextMarshaler存储为名称
+type MarshalStatus int
+
+const (
+	StatusActive MarshalStatus = iota + 1
+	StatusBlocked
+)
+
+var statusNames = map[MarshalStatus]string{StatusActive: "active", StatusBlocked: "blocked"}
+
+func (s MarshalStatus) MarshalText() ([]byte, error) {
+	return []byte(statusNames[s]), nil
+}
+
+func (s *MarshalStatus) UnmarshalText(data []byte) error {
+	for status, name := range statusNames {
+		if name == string(data) {
+			*s = status
+			return nil
+		}
+	}
+	return errors.New("unknown status " + string(data))
+}
+
+// MarshalBlob 只实现了BinaryMarshaler
+type MarshalBlob struct {
+	Data []byte
+}
+
+func (b MarshalBlob) MarshalBinary() ([]byte, error)     { return b.Data, nil }
+func (b *MarshalBlob) UnmarshalBinary(data []byte) error { b.Data = data; return nil }
+
+// MarshalPoint 只实现了json.Marshaler
+type MarshalPoint struct {
+	X, Y int
+}
+
+func (p MarshalPoint) MarshalJSON() ([]byte, error) {
+	return []byte("[" + strconv.Itoa(p.X) + "," + strconv.Itoa(p.Y) + "]"), nil
+}
+
+func (p *MarshalPoint) UnmarshalJSON(data []byte) error {
+	var xy [2]int
+	if err := json.Unmarshal(data, &xy); err != nil {
+		return err
+	}
+	p.X, p.Y = xy[0], xy[1]
+	return nil
+}
+
+// MarshalBoth 同时实现了Valuer与TextMarshaler Valuer优先
+type MarshalBoth string
+
+func (b MarshalBoth) RedisValue() string           { return "valuer:" + string(b) }
+func (b MarshalBoth) MarshalText() ([]byte, error) { return []byte("text:" + string(b)), nil }
+func (b *MarshalBoth) RedisScan(src interface{}) error {
+	*b = MarshalBoth(strings.TrimPrefix(string(src.([]byte)), "valuer:"))
+	return nil
+}
+func (b *MarshalBoth) UnmarshalText(data []byte) error { return errors.New("should use RedisScan") }
+
+type MarshalTest struct {
+	ID     string `redis:"primary"`
+	Status MarshalStatus
+	Blob   MarshalBlob
+	Point  *MarshalPoint
+	Both   MarshalBoth
+	Name   sql.NullString
+	Count  sql.NullInt64
+}
+
+func TestMarshalerCodec(t *testing.T) {
+	ctx := context.Background()
+	model := &MarshalTest{
+		ID:     "marshal1",
+		Status: StatusBlocked,
+		Blob:   MarshalBlob{Data: []byte{0x01, 0xff}},
+		Point:  &MarshalPoint{X: 3, Y: -4},
+		Both:   "x",
+		Name:   sql.NullString{String: "rorm", Valid: true},
+		Count:  sql.NullInt64{Int64: 42, Valid: true},
+	}
+	assert.Equal(t, map[string]string{
+		"ID":     "marshal1",
+		"Status": "blocked",
+		"Blob":   "\x01\xff",
+		"Point":  "[3,-4]",
+		"Both":   "valuer:x",
+		"Name":   "rorm",
+		"Count":  "42",
+	}, ConvertStructToMap(model))
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	result := &MarshalTest{ID: "marshal1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	//sql.NullString Valid为false时Value返回nil 不存储
+	err = redisClient.NewQuery().Updates(ctx, &MarshalTest{ID: "marshal1"}, map[string]interface{}{
+		"Status": StatusActive,
+		"Name":   sql.NullString{},
+	})
+	assert.Nil(t, err)
+	result = &MarshalTest{ID: "marshal1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusActive, result.Status)
+	assert.Equal(t, "rorm", result.Name.String)
+
+	var status MarshalStatus
+	assert.Nil(t, redisClient.NewQuery().PtrData("active", &status))
+	assert.Equal(t, StatusActive, status)
+	assert.NotNil(t, redisClient.NewQuery().PtrData("deleted", &status))
+}
+
+// MarshalPair 实现了driver.Valuer sql.Scanner与TextUnmarshaler 使用成对的Valuer/Scanner读写
+type MarshalPair string
+
+func (p MarshalPair) Value() (driver.Value, error) { return "value:" + string(p), nil }
+func (p *MarshalPair) Scan(src interface{}) error {
+	*p = MarshalPair(strings.TrimPrefix(string(src.([]byte)), "value:"))
+	return nil
+}
+func (p *MarshalPair) UnmarshalText(data []byte) error { return errors.New("should use Scan") }
+
+// MarshalMismatch 只实现了不成对的json.Marshaler与TextUnmarshaler
+type MarshalMismatch string
+
+func (m MarshalMismatch) MarshalJSON() ([]byte, error)     { return json.Marshal(string(m)) }
+func (m *MarshalMismatch) UnmarshalText(data []byte) error { *m = MarshalMismatch(data); return nil }
+
+func TestMarshalerCodecPair(t *testing.T) {
+	codec := lookupCodec(reflect.TypeOf(MarshalPair("")))
+	data, err := codec.Encode(reflect.ValueOf(MarshalPair("a")))
+	assert.Nil(t, err)
+	assert.Equal(t, "value:a", data)
+	var pair MarshalPair
+	assert.Nil(t, codec.Decode(data, reflect.ValueOf(&pair).Elem()))
+	assert.Equal(t, MarshalPair("a"), pair)
+
+	codec = lookupCodec(reflect.TypeOf(MarshalMismatch("")))
+	_, err = codec.Encode(reflect.ValueOf(MarshalMismatch("a")))
+	assert.NotNil(t, err)
+	var mismatch MarshalMismatch
+	assert.NotNil(t, codec.Decode(`"a"`, reflect.ValueOf(&mismatch).Elem()))
+}
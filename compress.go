@@ -0,0 +1,124 @@
+package rorm
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//HASH布局中redis:"compress:gzip" 的字段编码后超过compressmin(默认1024)字节时压缩后存储
+//压缩后的值以compressMarker + 算法名 + ":" 开头 没有该前缀的值按未压缩的数据读取
+//例如 Payload []byte `redis:"compress:gzip;compressmin:4096"`
+
+const (
+	compressMarker          = "\x00z:"
+	defaultCompressMinBytes = 1024
+)
+
+//Compressor 压缩算法 通过RegisterCompressor注册后可以在compress标签中使用 例如snappy zstd
+type Compressor interface {
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+var compressors sync.Map
+
+func init() {
+	RegisterCompressor("gzip", gzipCompressor{})
+}
+
+//RegisterCompressor 注册名为name的压缩算法
+func RegisterCompressor(name string, compressor Compressor) {
+	compressors.Store(name, compressor)
+}
+
+func lookupCompressor(name string) (Compressor, error) {
+	if compressor, ok := compressors.Load(name); ok {
+		return compressor.(Compressor), nil
+	}
+	return nil, fmt.Errorf("compressor %s not registered", name)
+}
+
+type gzipCompressor struct{}
+
+func (gzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+//compressCodec 压缩codec编码后的值
+type compressCodec struct {
+	codec    Codec
+	name     string
+	minBytes int
+}
+
+//newCompressCodec 字段设置了compress标签时包装codec
+func newCompressCodec(sf reflect.StructField, codec Codec) Codec {
+	settings := parseRedisTag(sf.Tag.Get("redis"))
+	name, ok := settings["compress"]
+	if !ok {
+		return codec
+	}
+	minBytes := defaultCompressMinBytes
+	if value, err := strconv.Atoi(settings["compressmin"]); err == nil {
+		minBytes = value
+	}
+	return compressCodec{codec: codec, name: name, minBytes: minBytes}
+}
+
+func (c compressCodec) Encode(v reflect.Value) (string, error) {
+	data, err := c.codec.Encode(v)
+	if err != nil || len(data) < c.minBytes {
+		return data, err
+	}
+	compressor, err := lookupCompressor(c.name)
+	if err != nil {
+		return "", err
+	}
+	compressed, err := compressor.Compress([]byte(data))
+	if err != nil {
+		return "", err
+	}
+	return compressMarker + c.name + ":" + string(compressed), nil
+}
+
+func (c compressCodec) Decode(data string, v reflect.Value) error {
+	if !strings.HasPrefix(data, compressMarker) {
+		return c.codec.Decode(data, v)
+	}
+	arrs := strings.SplitN(strings.TrimPrefix(data, compressMarker), ":", 2)
+	if len(arrs) != 2 {
+		return fmt.Errorf("invalid compressed value")
+	}
+	compressor, err := lookupCompressor(arrs[0])
+	if err != nil {
+		return err
+	}
+	decompressed, err := compressor.Decompress([]byte(arrs[1]))
+	if err != nil {
+		return err
+	}
+	return c.codec.Decode(string(decompressed), v)
+}
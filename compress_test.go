@@ -0,0 +1,52 @@
+package rorm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type CompressTest struct {
+	ID      string            `redis:"primary"`
+	Items   []string          `redis:"compress:gzip"`
+	Attrs   map[string]string `redis:"compress:gzip;compressmin:16"`
+	Comment string            `redis:"compress:snappy"`
+}
+
+func TestQuery_Compress(t *testing.T) {
+	ctx := context.Background()
+	items := make([]string, 200)
+	for i := range items {
+		items[i] = strings.Repeat("item", 4)
+	}
+	model := &CompressTest{ID: "c1", Items: items, Attrs: map[string]string{"a": "1"}}
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/c1"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(stored["Items"], compressMarker+"gzip:"))
+	assert.Less(t, len(stored["Items"]), len(items)*16)
+	//未超过阈值的值不压缩
+	assert.Equal(t, `{"a":"1"}`, stored["Attrs"])
+
+	result := &CompressTest{ID: "c1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	//未压缩的旧数据可以正常读取
+	err = redisClient.client.Do(ctx, "hset", key, "Items", `["old"]`).Err()
+	assert.Nil(t, err)
+	result = &CompressTest{ID: "c1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"old"}, result.Items)
+
+	//未注册的压缩算法
+	err = redisClient.NewQuery().Create(ctx, &CompressTest{ID: "c2", Comment: strings.Repeat("x", 2048)})
+	assert.NotNil(t, err)
+}
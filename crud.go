@@ -5,52 +5,248 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+
+	redis "github.com/go-redis/redis/v8"
 )
 
+//Create 写入数据 写入方式由Mode决定 默认为Upsert
 func (query *Query) Create(ctx context.Context, v interface{}) (err error) {
-	pipe := query.client.Pipeline()
-
-	key, err := query.getPrimaryKey(v)
+	if query.CreateMode == InsertOnly || query.CreateMode == UpdateOnly {
+		return query.guardedCreate(ctx, v)
+	}
+	return query.Save(ctx, v)
+}
 
-	if err != nil {
+//CreateMany 批量写入models models为结构体指针的slice 每BatchSize条数据使用一个pipeline
+//errs与models一一对应 errs[i]为models[i]写入失败的原因
+//有数据写入失败时err不为空 无法对应到单条数据的错误也通过err返回
+//Mode为InsertOnly或UpdateOnly时每条数据分别检查是否存在后写入 不使用pipeline
+func (query *Query) CreateMany(ctx context.Context, models interface{}) (errs []error, err error) {
+	val := reflect.ValueOf(models)
+	if val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Slice {
+		err = RormModelMustBeSlice
 		return
 	}
-	typ := reflect.TypeOf(v)
-	val := reflect.ValueOf(v).Elem()
-	num := val.NumField()
 
-	for i := 0; i < num; i++ {
-		fmt.Printf("Field %d:值=%v\n", i, val.Field(i))
-		//获取到struct标签，需要通过reflect.Type来获取tag标签的值
-		fieldName := typ.Elem().Field(i).Name
-		redisTag := typ.Elem().Field(i).Tag.Get("redis")
+	if query.CreateMode == InsertOnly || query.CreateMode == UpdateOnly {
+		return query.guardedCreateMany(ctx, val)
+	}
+
+	batchSize := query.batchSize()
+
+	errs = make([]error, val.Len())
+	failed := 0
+	for start := 0; start < val.Len(); start += batchSize {
+		end := start + batchSize
+		if end > val.Len() {
+			end = val.Len()
+		}
 
-		if redisTag == "-" {
+		var pending []int
+		var models []interface{}
+		for i := start; i < end; i++ {
+			model := val.Index(i)
+			if model.Kind() != reflect.Ptr && model.CanAddr() {
+				model = model.Addr()
+			}
+			if model.Kind() == reflect.Ptr && model.IsNil() {
+				errs[i] = RormPTRNeed
+				continue
+			}
+			if hookErr := callBeforeCreate(ctx, model.Interface()); hookErr != nil {
+				errs[i] = hookErr
+				continue
+			}
+			pending = append(pending, i)
+			models = append(models, model.Interface())
+		}
+		keyErrs, reserveErr := query.reserveAutoIncr(ctx, models)
+		if reserveErr != nil {
+			for _, i := range pending {
+				errs[i] = reserveErr
+			}
 			continue
 		}
 
-		field := val.Field(i)
+		//每条数据先写入单独的pipeline 全部命令准备成功后才加入这一批 失败的数据不会写入一部分
+		pipe := query.client.Pipeline()
+		keyIndex := map[string]int{}
+		for j, i := range pending {
+			if keyErrs[j] != nil {
+				errs[i] = keyErrs[j]
+				continue
+			}
+			record := newRecordPipeline()
+			key, createErr := query.pipeCreate(ctx, record, models[j])
+			if createErr != nil {
+				errs[i] = createErr
+				continue
+			}
+			if _, ok := keyIndex[key]; ok {
+				errs[i] = fmt.Errorf("%w: %s appears more than once in a batch", ErrDuplicateKey, key)
+				continue
+			}
+			for _, cmd := range recordedCmds(ctx, record) {
+				_ = pipe.Process(ctx, cmd)
+			}
+			keyIndex[key] = i
+		}
 
-		// //如果field的类型为指针，则一直取指针指到不为指针为止
-		// Value := field.Interface()
-		err = query.pipeHSet(ctx, pipe, key, fieldName, field)
-		if err != nil {
-			return err
+		cmds, _ := pipe.Exec(ctx)
+		for _, cmd := range cmds {
+			if cmd.Err() == nil || cmd.Err() == redis.Nil {
+				continue
+			}
+			if i, ok := cmdRecordIndex(cmd, keyIndex); ok {
+				if errs[i] == nil {
+					errs[i] = cmd.Err()
+				}
+			} else if err == nil {
+				err = cmd.Err()
+			}
+		}
+
+		for _, i := range keyIndex {
+			if errs[i] == nil {
+				model := val.Index(i)
+				if model.Kind() != reflect.Ptr && model.CanAddr() {
+					model = model.Addr()
+				}
+				errs[i] = callAfterCreate(ctx, model.Interface())
+			}
 		}
 	}
-	if query.ExpireTime > 0 {
-		_, err = pipe.Expire(ctx, key, query.ExpireTime).Result()
-		if err != nil {
-			return err
+
+	for _, recordErr := range errs {
+		if recordErr != nil {
+			failed++
 		}
 	}
+	if failed > 0 && err == nil {
+		err = fmt.Errorf("%d of %d records create failed", failed, len(errs))
+	}
+	return
+}
 
-	_, err = pipe.Exec(ctx)
-	if err != nil {
-		return err
+//guardedCreateMany 逐条以InsertOnly或UpdateOnly方式写入val中的数据
+func (query *Query) guardedCreateMany(ctx context.Context, val reflect.Value) (errs []error, err error) {
+	errs = make([]error, val.Len())
+	failed := 0
+	for i := 0; i < val.Len(); i++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+		model := val.Index(i)
+		if model.Kind() != reflect.Ptr && model.CanAddr() {
+			model = model.Addr()
+		}
+		if model.Kind() == reflect.Ptr && model.IsNil() {
+			errs[i] = RormPTRNeed
+		} else {
+			errs[i] = query.guardedCreate(ctx, model.Interface())
+		}
+		if errs[i] != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		err = fmt.Errorf("%d of %d records create failed", failed, len(errs))
 	}
 	return
+}
 
+//cmdRecordIndex 根据命令参数中的key找到命令对应的数据
+func cmdRecordIndex(cmd redis.Cmder, keyIndex map[string]int) (int, bool) {
+	for _, arg := range cmd.Args()[1:] {
+		if key, ok := arg.(string); ok {
+			if i, ok := keyIndex[key]; ok {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+//errCmdRecorded 记录命令的pipeline执行时返回的错误 命令没有被发送
+var errCmdRecorded = errors.New("command recorded")
+
+//cmdRecorder 拦截所有命令的执行
+type cmdRecorder struct{}
+
+func (cmdRecorder) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return ctx, errCmdRecorded
+}
+
+func (cmdRecorder) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	return nil
+}
+
+func (cmdRecorder) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return ctx, errCmdRecorded
+}
+
+func (cmdRecorder) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	return nil
+}
+
+//recorderClient 不连接redis的客户端 其pipeline只用于记录命令
+var recorderClient = func() *redis.Client {
+	client := redis.NewClient(&redis.Options{})
+	client.AddHook(cmdRecorder{})
+	return client
+}()
+
+//newRecordPipeline 得到只记录命令的pipeline 通过recordedCmds取出命令后加入真正的pipeline
+func newRecordPipeline() redis.Pipeliner {
+	return recorderClient.Pipeline()
+}
+
+//recordedCmds 取出pipe中记录的命令
+func recordedCmds(ctx context.Context, pipe redis.Pipeliner) []redis.Cmder {
+	cmds, _ := pipe.Exec(ctx)
+	return cmds
+}
+
+//pipeCreate 在pipeline中写入v的所有字段 返回v的key
+func (query *Query) pipeCreate(ctx context.Context, pipe redis.Pipeliner, v interface{}) (key string, err error) {
+	if err = query.fillAutoKeys(ctx, v); err != nil {
+		return
+	}
+	key, err = query.getPrimaryKey(v)
+
+	if err != nil {
+		return
+	}
+	typ := reflect.TypeOf(v)
+	val := reflect.ValueOf(v).Elem()
+
+	if err = query.pipeUpdateIndexes(ctx, pipe, key, v, fieldValues(val)); err != nil {
+		return
+	}
+
+	if getLayout(typ) != HashLayout {
+		err = query.pipeSetDocument(ctx, pipe, key, v)
+	} else if model, ok := v.(HashModel); ok && !query.Association {
+		err = query.pipeHashModel(ctx, pipe, key, model)
+	} else {
+		//忽略redis:"-"的字段 inline结构体展开为多个字段
+		err = walkFields("", val, func(fieldName string, schemaField *SchemaField, field reflect.Value) error {
+			return query.pipeHSet(ctx, pipe, key, fieldName, schemaField, field)
+		})
+	}
+	if err != nil {
+		return
+	}
+	if err = pipeSchemaVersion(ctx, pipe, key, typ); err != nil {
+		return
+	}
+	if query.ExpireTime > 0 {
+		pipe.Expire(ctx, key, query.ExpireTime)
+	}
+	return
 }
 
 func (query *Query) Find(ctx context.Context, v interface{}) (err error) {
@@ -63,46 +259,19 @@ func (query *Query) Find(ctx context.Context, v interface{}) (err error) {
 	switch reflect.TypeOf(v).Elem().Kind() {
 	case reflect.Struct:
 		//直接找到主键对应的的数据项
-		data, err := query.fetchData(ctx, v)
-		if err != nil {
-			return err
-		}
-		return query.retrieveData(data, v)
-
-	case reflect.Slice:
-		if query.Pattern == "" {
-			return errors.New(`Query Pattern can not be ""`)
-		}
-		keys, err := query.scanPatternKeys(query.Pattern)
+		key, data, err := query.fetchData(ctx, v)
 		if err != nil {
 			return err
 		}
-
-		mapData, err := query.getDataFromRedis(keys...)
-		// reflect.AppendSlice(s reflect.Value, t reflect.Value)
-		elementTyp := reflect.TypeOf(v).Elem().Elem()
-		value := reflect.ValueOf(v).Elem()
-		fmt.Println(value)
-		var realTyp reflect.Type = elementTyp
-		if elementTyp.Kind() == reflect.Ptr {
-			realTyp = elementTyp.Elem()
-		}
-
-		for _, mapdata := range mapData {
-			element := reflect.New(realTyp)
-
-			err = query.retrieveData(mapdata, element.Interface())
-			if err != nil {
+		if data != nil {
+			if err = query.retrieveData(key, data, v); err != nil {
 				return err
 			}
-			if realTyp.Kind() == reflect.Ptr {
-				value = reflect.Append(value, element)
-			} else {
-				value = reflect.Append(value, element.Elem())
-			}
 		}
+		return callAfterFind(ctx, v)
 
-		reflect.ValueOf(v).Elem().Set(value)
+	case reflect.Slice:
+		_, err = query.findSlice(ctx, v)
 
 	}
 	return
@@ -120,8 +289,6 @@ func (query *Query) Update(ctx context.Context, model interface{}, fieldName str
 		return
 	}
 
-	line := query.client.Pipeline()
-
 	typ := reflect.TypeOf(model)
 
 	if typ.Kind() == reflect.Ptr {
@@ -133,20 +300,26 @@ func (query *Query) Update(ctx context.Context, model interface{}, fieldName str
 		return
 	}
 
-	if _, ok := typ.FieldByName(fieldName); !ok {
+	field, ok := lookupModelField(typ, fieldName)
+	if !ok {
 		err = RormFieldNotExist
 		return
 	}
 
-	err = query.pipeHSet(ctx, line, hashKey, fieldName, reflect.ValueOf(v))
-	if err != nil {
-		return err
+	if versionField, ok := getVersionField(typ); ok && versionField.Name == field.name {
+		err = ErrVersionReadOnly
+		return
 	}
 
-	if _, err = line.Exec(ctx); err != nil {
+	if err = callBeforeUpdate(ctx, model); err != nil {
 		return
 	}
-	return
+
+	err = query.updateFields(ctx, hashKey, model, []updateValue{{modelField: field, value: reflect.ValueOf(v)}})
+	if err != nil {
+		return
+	}
+	return callAfterUpdate(ctx, model)
 }
 
 func (query *Query) Updates(ctx context.Context, model interface{}, data map[string]interface{}) (err error) {
@@ -154,34 +327,296 @@ func (query *Query) Updates(ctx context.Context, model interface{}, data map[str
 	if err != nil {
 		return err
 	}
-	datatemp := map[string]string{}
-	if datatemp, err = query.client.HGetAll(ctx, hashKey).Result(); len(datatemp) == 0 || err != nil {
+	length, err := query.client.Exists(ctx, hashKey).Result()
+	if err != nil || length == 0 {
 		err = RormPrimaryKeyNotFound
 		return
 	}
 
-	line := query.client.Pipeline()
-
 	typ := reflect.TypeOf(model)
 
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
 	}
 
+	versionField, hasVersion := getVersionField(typ)
+	values := make([]updateValue, 0, len(data))
 	for key, value := range data {
-
-		if _, ok := typ.FieldByName(key); !ok {
+		field, ok := lookupModelField(typ, key)
+		if !ok {
 			err = RormFieldNotExist
 			return
 		}
+		values = append(values, updateValue{modelField: field, value: reflect.ValueOf(value)})
+		if hasVersion && versionField.Name == field.name {
+			err = ErrVersionReadOnly
+			return
+		}
+	}
 
-		err = query.pipeHSet(ctx, line, hashKey, key, reflect.ValueOf(value))
+	if err = callBeforeUpdate(ctx, model); err != nil {
+		return
+	}
+
+	err = query.updateFields(ctx, hashKey, model, values)
+	if err != nil {
+		return
+	}
+	return callAfterUpdate(ctx, model)
+}
+
+//Delete 删除model主键对应的HMAP
+//SubModel(true)时 同时删除通过foreignKey关联的子model 所有删除在同一个pipeline中执行
+func (query *Query) Delete(ctx context.Context, model interface{}) (err error) {
+	hashKey, err := query.getPrimaryKey(model)
+	if err != nil {
+		return err
+	}
+
+	if err = callBeforeDelete(ctx, model); err != nil {
+		return
+	}
+
+	models := []interface{}{model}
+	if query.Association {
+		subModels, err := query.getAssociationModels(ctx, hashKey, model)
 		if err != nil {
 			return err
 		}
+		models = append(models, subModels...)
 	}
+
+	line := query.client.Pipeline()
+	var delCmd *redis.IntCmd
+	//集群模式下key可能不在同一个slot 因此逐个删除
+	for _, m := range models {
+		key, err := query.getPrimaryKey(m)
+		if err != nil {
+			return err
+		}
+		if err = query.pipeDeleteIndexes(ctx, line, key, m); err != nil {
+			return err
+		}
+		cmd := line.Del(ctx, key)
+		if delCmd == nil {
+			delCmd = cmd
+		}
+	}
+
 	if _, err = line.Exec(ctx); err != nil {
 		return
 	}
-	return
+	if delCmd.Val() == 0 {
+		return RormDataNotFound
+	}
+	return callAfterDelete(ctx, model)
+}
+
+//Exists model主键对应的数据是否存在
+func (query *Query) Exists(ctx context.Context, model interface{}) (exists bool, err error) {
+	hashKey, err := query.getPrimaryKey(model)
+	if err != nil {
+		return
+	}
+	count, err := query.client.Exists(ctx, hashKey).Result()
+	if err != nil {
+		return
+	}
+	return count > 0, nil
+}
+
+//Count 统计满足Where WhereField Range条件的model类型数据的数量 不受Limit Offset影响
+//只有Range条件时直接使用ZCOUNT 只有Where条件时通过SCAN统计 不会读取数据本身
+func (query *Query) Count(ctx context.Context, model interface{}) (count int64, err error) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		err = RormModelMustBeStruct
+		return
+	}
+
+	if len(query.WhereValues) == 0 && query.RangeField != "" && (query.OrderField == "" || query.OrderField == query.RangeField) {
+		if !hasRangeIndex(typ, query.RangeField) {
+			return 0, fmt.Errorf("%w: no range index for field %s", RormIndexNotFound, query.RangeField)
+		}
+		min, err := formatRangeBound(query.RangeMin, "-inf")
+		if err != nil {
+			return 0, err
+		}
+		max, err := formatRangeBound(query.RangeMax, "+inf")
+		if err != nil {
+			return 0, err
+		}
+		return query.client.ZCount(ctx, query.rangeIndexKey(typ, query.RangeField), min, max).Result()
+	}
+
+	if len(query.WhereValues) == 0 && query.RangeField == "" && query.OrderField == "" {
+		if query.Pattern == "" {
+			return 0, errors.New(`Query Pattern can not be ""`)
+		}
+		var cursor uint64
+		for {
+			keys, next, err := query.client.Scan(ctx, cursor, query.scanPattern(), int64(query.batchSize())).Result()
+			if err != nil {
+				return 0, err
+			}
+			count += int64(len(keys))
+			if cursor = next; cursor == 0 {
+				return count, nil
+			}
+		}
+	}
+
+	countQuery := *query
+	countQuery.LimitValue, countQuery.OffsetValue = 0, 0
+	keys, err := countQuery.findKeys(ctx, typ)
+	if err != nil {
+		return
+	}
+	return int64(len(keys)), nil
+}
+
+//Pluck 读取满足条件的所有数据的fieldName字段到v中 v为slice指针
+//使用WhereField Range OrderBy时需要先通过Model指定数据类型
+func (query *Query) Pluck(ctx context.Context, fieldName string, v interface{}) (err error) {
+	if reflect.TypeOf(v).Kind() != reflect.Ptr || reflect.TypeOf(v).Elem().Kind() != reflect.Slice {
+		return RormModelMustBeSlice
+	}
+
+	typ := query.ModelType
+	field := modelField{name: fieldName, stored: fieldName, sf: &SchemaField{}}
+	if typ != nil {
+		var ok bool
+		if field, ok = lookupModelField(typ, fieldName); !ok {
+			return RormFieldNotExist
+		}
+	} else if len(query.WhereValues) > 0 || query.RangeField != "" || query.OrderField != "" {
+		return errors.New("Pluck with WhereField Range or OrderBy need Model")
+	}
+
+	keys, err := query.findKeys(ctx, typ)
+	if err != nil {
+		return
+	}
+
+	elemTyp := reflect.TypeOf(v).Elem().Elem()
+	value := reflect.ValueOf(v).Elem()
+	batchSize := query.batchSize()
+	for start := 0; start < len(keys); start += batchSize {
+		end := start + batchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		if getLayout(typ) != HashLayout {
+			if value, err = query.pluckDocuments(ctx, typ, field.name, keys[start:end], value); err != nil {
+				return
+			}
+			continue
+		}
+
+		values, err := query.pluckHash(ctx, typ, field, keys[start:end])
+		if err != nil {
+			return err
+		}
+		for _, data := range values {
+			element := reflect.New(elemTyp).Elem()
+			if err = decodePlainField(field.stored, data, field.sf, element); err != nil {
+				return err
+			}
+			value = reflect.Append(value, element)
+		}
+	}
+	reflect.ValueOf(v).Elem().Set(value)
+	return nil
+}
+
+//pluckHash 读取HASH布局的keys中field字段存储的值 加密字段返回解密后的值 与Find相同 没有存储该字段的数据使用默认值
+//typ注册了迁移函数时读取所有字段迁移后再取值 不存在的数据被忽略
+func (query *Query) pluckHash(ctx context.Context, typ reflect.Type, field modelField, keys []string) (values []string, err error) {
+	var defaultValue string
+	var hasDefault, versioned bool
+	if typ != nil {
+		defaultValue, hasDefault = field.sf.defaultValue, field.sf.hasDefault
+		versioned = getSchema(typ).SchemaVersion > 0
+	}
+
+	pipe := query.client.Pipeline()
+	getCmds := make([]*redis.StringCmd, 0, len(keys))
+	allCmds := make([]*redis.StringStringMapCmd, 0, len(keys))
+	existsCmds := make([]*redis.IntCmd, 0, len(keys))
+	for _, key := range keys {
+		if versioned {
+			allCmds = append(allCmds, pipe.HGetAll(ctx, key))
+			continue
+		}
+		getCmds = append(getCmds, pipe.HGet(ctx, key, field.stored))
+		if hasDefault {
+			existsCmds = append(existsCmds, pipe.Exists(ctx, key))
+		}
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return
+	}
+
+	for i, key := range keys {
+		var data string
+		var ok, exists bool
+		if versioned {
+			stored := allCmds[i].Val()
+			if err = query.migrate(ctx, key, typ, stored); err != nil {
+				return nil, err
+			}
+			data, ok = stored[field.stored]
+			exists = len(stored) > 0
+		} else {
+			data, err = getCmds[i].Result()
+			if err != nil && err != redis.Nil {
+				return nil, err
+			}
+			ok = err == nil
+			exists = hasDefault && existsCmds[i].Val() > 0
+		}
+		if ok {
+			if data, err = query.openField(key, field.stored, data, field.sf); err != nil {
+				return nil, err
+			}
+		}
+		if !ok && exists && hasDefault {
+			data, ok = defaultValue, true
+		}
+		if ok {
+			values = append(values, data)
+		}
+	}
+	return values, nil
+}
+
+//pluckDocuments 读取文档存储方式的keys 将其中fieldName字段的值追加到value中
+func (query *Query) pluckDocuments(ctx context.Context, typ reflect.Type, fieldName string, keys []string, value reflect.Value) (reflect.Value, error) {
+	data, err := query.getDataFromRedis(ctx, typ, keys...)
+	if err != nil {
+		return value, err
+	}
+	for _, key := range keys {
+		if len(data[key]) == 0 {
+			continue
+		}
+		model := newModel(typ)
+		if err = query.retrieveData(key, data[key], model); err != nil {
+			return value, err
+		}
+		field, ok := fieldByName(reflect.ValueOf(model).Elem(), fieldName, false)
+		if !ok {
+			continue
+		}
+		element := reflect.New(value.Type().Elem()).Elem()
+		if err = assignValue(element, field); err != nil {
+			return value, err
+		}
+		value = reflect.Append(value, element)
+	}
+	return value, nil
 }
@@ -2,8 +2,10 @@ package rorm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -265,3 +267,230 @@ func TestBFRRedis_FindSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestQuery_Delete(t *testing.T) {
+	testStringPtr := "testStringPtr"
+	type args struct {
+		ctx   context.Context
+		model *RedisTest
+	}
+	tests := []struct {
+		name    string
+		query   *Query
+		create  []interface{}
+		args    args
+		wantErr bool
+	}{
+		{
+			name:  "delete with key not exist in redis",
+			query: redisClient.NewQuery(),
+			args: args{
+				ctx:   context.Background(),
+				model: &RedisTest{ID: "delete_not_exist"},
+			},
+			wantErr: true,
+		},
+		{
+			name:  "delete with association",
+			query: redisClient.NewQuery().SubModel(true),
+			create: []interface{}{
+				&RedisTest{ID: "delete16", TESTID: "deleteInner16", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+				&TestStruct{TEST1: "deleteInner16", SLICE2: []string{"asd"}},
+			},
+			args: args{
+				ctx:   context.Background(),
+				model: &RedisTest{ID: "delete16"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, model := range tt.create {
+				if err := redisClient.NewQuery().Create(tt.args.ctx, model); err != nil {
+					t.Fatalf("Query.Create() error = %v", err)
+				}
+			}
+			if err := tt.query.Delete(tt.args.ctx, tt.args.model); (err != nil) != tt.wantErr {
+				t.Errorf("Query.Delete() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr {
+				for _, model := range tt.create {
+					assert.Equal(t, RormDataNotFound, redisClient.NewQuery().Find(tt.args.ctx, model))
+				}
+			}
+		})
+	}
+}
+
+func TestQuery_CreateMany(t *testing.T) {
+	testStringPtr := "testStringPtr"
+	type args struct {
+		ctx    context.Context
+		models []*RedisTest
+	}
+	tests := []struct {
+		name     string
+		query    *Query
+		args     args
+		wantErrs []bool
+		wantErr  bool
+	}{
+		{
+			name:  "create many in chunked pipelines with association",
+			query: redisClient.NewQuery().SubModel(true).Batch(2),
+			args: args{
+				ctx: context.Background(),
+				models: []*RedisTest{
+					{ID: "many1", PTRTEST: &testStringPtr, TESTID: "manyInner1", TestStruct: &TestStruct{TEST1: "manyInner1"}},
+					{ID: "many2", PTRTEST: &testStringPtr, TESTID: "manyInner2", TestStruct: &TestStruct{TEST1: "manyInner2"}},
+					{ID: "many3", PTRTEST: &testStringPtr, TESTID: "manyInner3", TestStruct: &TestStruct{TEST1: "manyInner3"}},
+				},
+			},
+			wantErrs: []bool{false, false, false},
+			wantErr:  false,
+		},
+		{
+			name:  "create many with nil record",
+			query: redisClient.NewQuery(),
+			args: args{
+				ctx: context.Background(),
+				models: []*RedisTest{
+					{ID: "many4", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+					nil,
+				},
+			},
+			wantErrs: []bool{false, true},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, err := tt.query.CreateMany(tt.args.ctx, tt.args.models)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Query.CreateMany() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for i, model := range tt.args.models {
+				if (errs[i] != nil) != tt.wantErrs[i] {
+					t.Errorf("Query.CreateMany() errs[%d] = %v, wantErr %v", i, errs[i], tt.wantErrs[i])
+				}
+				if model == nil || errs[i] != nil {
+					continue
+				}
+				assert.Nil(t, redisClient.NewQuery().Find(tt.args.ctx, &RedisTest{ID: model.ID}))
+				if tt.query.Association {
+					assert.Nil(t, redisClient.NewQuery().Find(tt.args.ctx, &TestStruct{TEST1: model.TESTID}))
+				}
+			}
+		})
+	}
+}
+
+type CreateManyPartialTest struct {
+	ID     string `redis:"primary"`
+	Group  string `redis:"index"`
+	Secret string `redis:"encrypt;omitempty"`
+}
+
+func TestQuery_CreateManyPartial(t *testing.T) {
+	ctx := context.Background()
+	_ = redisClient.NewQuery().Delete(ctx, &CreateManyPartialTest{ID: "partial2"})
+
+	//没有设置KeyProvider 加密字段失败的数据不能留下索引
+	query := NewBFRRedis(NewDefaultOptions(), nil).NewQuery()
+	models := []*CreateManyPartialTest{
+		{ID: "partial1", Group: "partial", Secret: "s"},
+		{ID: "partial2", Group: "partial"},
+		{ID: "partial2", Group: "partial"},
+	}
+	errs, err := query.CreateMany(ctx, models)
+	assert.NotNil(t, err)
+	assert.True(t, errors.Is(errs[0], ErrKeyProviderNotSet), errs[0])
+	assert.Nil(t, errs[1])
+	assert.True(t, errors.Is(errs[2], ErrDuplicateKey), errs[2])
+
+	assert.Equal(t, RormDataNotFound, query.Find(ctx, &CreateManyPartialTest{ID: "partial1"}))
+	var found []*CreateManyPartialTest
+	err = query.WhereField("Group", "partial").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, models[1:2], found)
+}
+
+func TestQuery_Exists(t *testing.T) {
+	ctx := context.Background()
+	if err := redisClient.NewQuery().Create(ctx, &IterTest{ID: "exists1"}); err != nil {
+		t.Fatalf("Query.Create() error = %v", err)
+	}
+	tests := []struct {
+		name  string
+		model *IterTest
+		want  bool
+	}{
+		{name: "record exists", model: &IterTest{ID: "exists1"}, want: true},
+		{name: "record not exists", model: &IterTest{ID: "exists_not_exist"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redisClient.NewQuery().Exists(ctx, tt.model)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type CountTest struct {
+	ID     string  `redis:"primary"`
+	TEST2  float64 `redis:"index:range"`
+	TESTID string  `redis:"index"`
+}
+
+func TestQuery_CountAndPluck(t *testing.T) {
+	ctx := context.Background()
+	models := []*CountTest{
+		{ID: "count1", TEST2: 1.0, TESTID: "count"},
+		{ID: "count2", TEST2: 2.0, TESTID: "count"},
+		{ID: "count3", TEST2: 3.0, TESTID: "count"},
+	}
+	if _, err := redisClient.NewQuery().CreateMany(ctx, models); err != nil {
+		t.Fatalf("Query.CreateMany() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     *Query
+		wantCount int64
+		wantPluck []float64
+	}{
+		{
+			name:      "pattern",
+			query:     redisClient.NewQuery().Where("*CountTest/ID/count*"),
+			wantCount: 3,
+			wantPluck: []float64{1.0, 2.0, 3.0},
+		},
+		{
+			name:      "where field ignore limit",
+			query:     redisClient.NewQuery().Model(&CountTest{}).WhereField("TESTID", "count").OrderBy("TEST2", true).Limit(2),
+			wantCount: 3,
+			wantPluck: []float64{3.0, 2.0},
+		},
+		{
+			name:      "range",
+			query:     redisClient.NewQuery().Model(&CountTest{}).WhereField("TESTID", "count").Range("TEST2", 2.0, nil),
+			wantCount: 2,
+			wantPluck: []float64{2.0, 3.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := tt.query.Count(ctx, &CountTest{})
+			assert.Nil(t, err)
+			assert.Equal(t, tt.wantCount, count)
+
+			values := []float64{}
+			assert.Nil(t, tt.query.Pluck(ctx, "TEST2", &values))
+			if tt.query.OrderField == "" && tt.query.RangeField == "" {
+				sort.Float64s(values)
+			}
+			assert.Equal(t, tt.wantPluck, values)
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package rorm
+
+import (
+	"reflect"
+)
+
+//匿名的结构体字段与encoding/json相同 其中的字段提升到外层结构体 存储在同一个HMAP中
+//例如 type User struct { BaseModel; Name string } 中BaseModel的ID CreatedAt等字段存储为ID CreatedAt
+//提升的字段同样可以设置primary index version等标签 外层的同名字段优先 同一层中同名的字段都被忽略
+//设置了inline或redis:"-"的匿名字段不提升 有自己的Codec的匿名字段也不提升 与普通字段一样整体编码
+
+//isEmbedded 匿名字段是否需要提升
+func isEmbedded(sf reflect.StructField) bool {
+	if !sf.Anonymous || isInline(sf) || sf.Tag.Get("redis") == "-" {
+		return false
+	}
+	typ := sf.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType {
+		return false
+	}
+	return !hasRegisteredCodec(sf.Type) && !hasRegisteredCodec(typ)
+}
+
+//hasRegisteredCodec typ是否通过RegisterCodec或实现的接口定义了转换方式
+func hasRegisteredCodec(typ reflect.Type) bool {
+	if _, ok := codecs.Load(typ); ok {
+		return true
+	}
+	_, ok := lookupMarshalerCodec(typ)
+	return ok
+}
+
+//promotedField 展开匿名字段后的字段 depth为所在的层数
+type promotedField struct {
+	sf    reflect.StructField
+	depth int
+}
+
+//structFields 得到typ中需要存储的字段 匿名结构体中的字段提升到外层 Index为相对typ的路径
+func structFields(typ reflect.Type) []reflect.StructField {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	var fields []promotedField
+	collectFields(typ, nil, 0, map[reflect.Type]bool{}, &fields)
+
+	depths := map[string]int{}
+	counts := map[string]int{}
+	for _, field := range fields {
+		name := field.sf.Name
+		if depth, ok := depths[name]; ok && depth < field.depth {
+			continue
+		} else if ok && depth == field.depth {
+			counts[name]++
+			continue
+		}
+		depths[name] = field.depth
+		counts[name] = 1
+	}
+
+	result := make([]reflect.StructField, 0, len(fields))
+	for _, field := range fields {
+		name := field.sf.Name
+		if depths[name] == field.depth && counts[name] == 1 {
+			result = append(result, field.sf)
+		}
+	}
+	return result
+}
+
+func collectFields(typ reflect.Type, index []int, depth int, visited map[reflect.Type]bool, fields *[]promotedField) {
+	if visited[typ] {
+		return
+	}
+	visited[typ] = true
+	defer delete(visited, typ)
+
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		sf.Index = append(append([]int{}, index...), i)
+		if isEmbedded(sf) {
+			embedded := sf.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			collectFields(embedded, sf.Index, depth+1, visited, fields)
+			continue
+		}
+		*fields = append(*fields, promotedField{sf: sf, depth: depth})
+	}
+}
+
+//fieldByIndex 按structFields得到的Index读取字段 路径上有nil的匿名指针时
+//create为true则创建 否则返回无效的Value
+func fieldByIndex(val reflect.Value, index []int, create bool) reflect.Value {
+	for i, x := range index {
+		if i > 0 && val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				if !create || !val.CanSet() {
+					return reflect.Value{}
+				}
+				val.Set(reflect.New(val.Type().Elem()))
+			}
+			val = val.Elem()
+		}
+		val = val.Field(x)
+	}
+	return val
+}
+
+//fieldValues 得到结构体中以Go字段名为key的字段值 用于更新索引
+func fieldValues(val reflect.Value) map[string]reflect.Value {
+	values := map[string]reflect.Value{}
+	for _, field := range getSchema(val.Type()).Fields {
+		values[field.Name] = fieldByIndex(val, field.Index, false)
+	}
+	return values
+}
@@ -0,0 +1,149 @@
+package rorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type EmbedBase struct {
+	ID        string `redis:"primary"`
+	Version   int64  `redis:"version"`
+	CreatedAt time.Time
+}
+
+type EmbedTest struct {
+	EmbedBase
+	Name  string `redis:"index"`
+	Score int    `redis:"index:range"`
+}
+
+type EmbedPtrTest struct {
+	*EmbedBase
+	Note      string
+	CreatedAt string
+}
+
+func TestQuery_Embedded(t *testing.T) {
+	ctx := context.Background()
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	model := &EmbedTest{EmbedBase: EmbedBase{ID: "em1", CreatedAt: created}, Name: "alice", Score: 5}
+
+	key, err := redisClient.NewQuery().getPrimaryKey(model)
+	assert.Nil(t, err)
+	assert.Equal(t, GetTypeFullName(model)+"/ID/em1", key)
+
+	err = redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"ID":        "em1",
+		"Version":   "0",
+		"CreatedAt": created.Format(time.RFC3339Nano),
+		"Name":      "alice",
+		"Score":     "5",
+	}, stored)
+
+	result := &EmbedTest{EmbedBase: EmbedBase{ID: "em1"}}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	//提升的version字段
+	err = redisClient.NewQuery().Update(ctx, result, "Name", "bob")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Version)
+	err = redisClient.NewQuery().Update(ctx, result, "Version", 3)
+	assert.Equal(t, ErrVersionReadOnly, err)
+	err = redisClient.NewQuery().Update(ctx, result, "EmbedBase", EmbedBase{})
+	assert.Equal(t, RormFieldNotExist, err)
+
+	var found []EmbedTest
+	err = redisClient.NewQuery().WhereField("Name", "bob").Find(ctx, &found)
+	assert.Nil(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "em1", found[0].ID)
+	}
+	found = nil
+	err = redisClient.NewQuery().Range("Score", 1, 10).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+
+	//匿名指针 外层的同名字段优先
+	ptrModel := &EmbedPtrTest{EmbedBase: &EmbedBase{ID: "emp1", CreatedAt: created}, Note: "n", CreatedAt: "today"}
+	err = redisClient.NewQuery().Create(ctx, ptrModel)
+	assert.Nil(t, err)
+	ptrKey := GetTypeFullName(ptrModel) + "/ID/emp1"
+	stored, err = redisClient.client.HGetAll(ctx, ptrKey).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "today", stored["CreatedAt"])
+
+	ptrResult := &EmbedPtrTest{EmbedBase: &EmbedBase{ID: "emp1"}}
+	err = redisClient.NewQuery().Find(ctx, ptrResult)
+	assert.Nil(t, err)
+	assert.Equal(t, &EmbedPtrTest{EmbedBase: &EmbedBase{ID: "emp1"}, Note: "n", CreatedAt: "today"}, ptrResult)
+
+	var ptrFound []*EmbedPtrTest
+	err = redisClient.NewQuery().Where(GetTypeFullName(ptrModel)+"/ID/emp*").Find(ctx, &ptrFound)
+	assert.Nil(t, err)
+	if assert.Len(t, ptrFound, 1) {
+		assert.Equal(t, "emp1", ptrFound[0].ID)
+	}
+
+	_, err = redisClient.NewQuery().getPrimaryKey(&EmbedPtrTest{})
+	assert.Equal(t, RormPrimaryKeyNotFound, err)
+}
+
+type EmbedCoord struct {
+	Lat, Lng int
+}
+
+type embedCoordCodec struct{}
+
+func (embedCoordCodec) Encode(v reflect.Value) (string, error) {
+	coord := v.Interface().(EmbedCoord)
+	return fmt.Sprintf("%d,%d", coord.Lat, coord.Lng), nil
+}
+
+func (embedCoordCodec) Decode(data string, v reflect.Value) error {
+	var coord EmbedCoord
+	if _, err := fmt.Sscanf(data, "%d,%d", &coord.Lat, &coord.Lng); err != nil {
+		return err
+	}
+	v.Set(reflect.ValueOf(coord))
+	return nil
+}
+
+//EmbedCodecTest 有Codec的匿名字段整体编码 不提升其中的字段
+type EmbedCodecTest struct {
+	ID string `redis:"primary"`
+	MarshalPoint
+	EmbedCoord
+}
+
+func TestQuery_EmbeddedCodec(t *testing.T) {
+	ctx := context.Background()
+	RegisterCodec(reflect.TypeOf(EmbedCoord{}), embedCoordCodec{})
+	model := &EmbedCodecTest{ID: "emc1", MarshalPoint: MarshalPoint{X: 1, Y: 2}, EmbedCoord: EmbedCoord{Lat: 3, Lng: 4}}
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	key := GetTypeFullName(model) + "/ID/emc1"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"ID":           "emc1",
+		"MarshalPoint": "[1,2]",
+		"EmbedCoord":   "3,4",
+	}, stored)
+
+	result := &EmbedCodecTest{ID: "emc1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+}
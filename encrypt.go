@@ -0,0 +1,274 @@
+package rorm
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//HASH布局中redis:"encrypt" 的字段编码(及压缩)后使用AES-GCM加密 Find时解密
+//密文以encryptMarker + 密钥ID + ":" 开头 之后为nonce与密文
+//数据的key与字段名作为附加数据参与认证 密文复制到其他数据或字段后无法解密
+//没有该前缀的值默认返回ErrPlaintextField 迁移未加密的旧数据时通过AllowPlaintext按明文读取
+//文档存储方式整个结构体以明文序列化 索引中存储的是明文 这两种情况下使用encrypt时返回ErrEncryptNotSupported
+
+const encryptMarker = "\x00e:"
+
+var (
+	ErrKeyProviderNotSet   = errors.New("key provider not set for encrypted field")
+	ErrEncryptNotSupported = errors.New("encrypt can only be used on unindexed fields of hash layout models")
+	ErrPlaintextField      = errors.New("encrypted field is stored in plaintext")
+)
+
+//KeyProvider 提供加密字段使用的密钥 通过BFRRedis.SetKeyProvider设置
+//密钥长度为16 24或32字节 分别对应AES-128 AES-192 AES-256
+type KeyProvider interface {
+	//CurrentKey 返回写入时使用的密钥及其ID ID中不能包含:
+	CurrentKey() (id string, key []byte, err error)
+	//Key 返回ID对应的密钥 用于解密使用旧密钥写入的数据
+	Key(id string) ([]byte, error)
+}
+
+//KeyRing 固定密钥的KeyProvider Current为当前使用的密钥ID
+type KeyRing struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (ring *KeyRing) CurrentKey() (string, []byte, error) {
+	key, err := ring.Key(ring.Current)
+	return ring.Current, key, err
+}
+
+func (ring *KeyRing) Key(id string) ([]byte, error) {
+	if key, ok := ring.Keys[id]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("encryption key %s not found", id)
+}
+
+//SetKeyProvider 设置加密字段使用的KeyProvider 之后创建的Query生效
+func (r *BFRRedis) SetKeyProvider(provider KeyProvider) {
+	r.keyProvider = provider
+}
+
+//AllowPlaintext 加密字段存储的值没有加密前缀时按明文读取 只用于迁移未加密的旧数据
+//Reencrypt同样需要设置才会加密明文存储的值
+func (query *Query) AllowPlaintext(flag bool) *Query {
+	query.PlaintextFallback = flag
+	return query
+}
+
+//isEncrypted 字段是否设置了encrypt
+func isEncrypted(sf reflect.StructField) bool {
+	_, ok := parseRedisTag(sf.Tag.Get("redis"))["encrypt"]
+	return ok
+}
+
+//checkEncryptTags 检查schema中encrypt的使用 错误在解析schema时记录 写入与读取时返回
+func checkEncryptTags(schema *ModelSchema) error {
+	if schema.Layout != HashLayout {
+		if name, ok := findEncrypted(schema.Type, map[reflect.Type]bool{}); ok {
+			return fmt.Errorf("%w: %s is stored in a document", ErrEncryptNotSupported, name)
+		}
+		return nil
+	}
+	for _, field := range schema.Fields {
+		if _, ok := field.Tags["index"]; ok && field.encrypted {
+			return fmt.Errorf("%w: %s is indexed", ErrEncryptNotSupported, field.Name)
+		}
+	}
+	return nil
+}
+
+//findEncrypted 查找typ及其嵌套的结构体中设置了encrypt的字段
+func findEncrypted(typ reflect.Type, visited map[reflect.Type]bool) (string, bool) {
+	for typ.Kind() == reflect.Ptr || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || visited[typ] {
+		return "", false
+	}
+	visited[typ] = true
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if isEncrypted(sf) {
+			return sf.Name, true
+		}
+		if name, ok := findEncrypted(sf.Type, visited); ok {
+			return sf.Name + "." + name, true
+		}
+	}
+	return "", false
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//isSealedWith data是否已经使用ID为id的密钥加密
+func isSealedWith(data string, id string) bool {
+	return strings.HasPrefix(data, encryptMarker+id+":")
+}
+
+//encryptAAD 加密hashKey中field字段时使用的附加数据
+func encryptAAD(hashKey string, field string) []byte {
+	return []byte(hashKey + "\x00" + field)
+}
+
+//seal 使用当前密钥加密data aad为encryptAAD得到的附加数据
+func (query *Query) seal(data string, aad []byte) (string, error) {
+	if query.keyProvider == nil {
+		return "", ErrKeyProviderNotSet
+	}
+	id, key, err := query.keyProvider.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return encryptMarker + id + ":" + string(gcm.Seal(nonce, nonce, []byte(data), aad)), nil
+}
+
+//open 解密seal得到的值 aad必须与加密时相同 没有加密前缀的值只有AllowPlaintext时原样返回
+func (query *Query) open(data string, aad []byte) (string, error) {
+	if !strings.HasPrefix(data, encryptMarker) {
+		if query.PlaintextFallback {
+			return data, nil
+		}
+		return "", ErrPlaintextField
+	}
+	if query.keyProvider == nil {
+		return "", ErrKeyProviderNotSet
+	}
+	arrs := strings.SplitN(strings.TrimPrefix(data, encryptMarker), ":", 2)
+	if len(arrs) != 2 {
+		return "", errors.New("invalid encrypted value")
+	}
+	key, err := query.keyProvider.Key(arrs[0])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	sealed := []byte(arrs[1])
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+//getEncryptedFields 得到typ中设置了encrypt的字段存储在HMAP中的名称
+func getEncryptedFields(prefix string, typ reflect.Type) (fields []string) {
+	for _, field := range getSchema(typ).Fields {
+		name := inlineName(prefix, field.Stored)
+		if field.inline {
+			fields = append(fields, getEncryptedFields(name, field.Type)...)
+		} else if field.encrypted {
+			fields = append(fields, name)
+		}
+	}
+	return
+}
+
+//Reencrypt 使用当前密钥重新加密model类型数据中的加密字段 返回改写的数据条数
+//数据的范围由Where WhereField等条件决定 没有条件时处理该类型的所有数据
+//设置了AllowPlaintext时明文存储的旧数据同样会被加密 只支持HASH布局
+func (query *Query) Reencrypt(ctx context.Context, model interface{}) (count int, err error) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() != reflect.Ptr {
+		return 0, RormPTRNeed
+	}
+	if getLayout(typ) != HashLayout {
+		return 0, errors.New("reencrypt only support hash layout")
+	}
+	if query.keyProvider == nil {
+		return 0, ErrKeyProviderNotSet
+	}
+	fields := getEncryptedFields("", typ)
+	if len(fields) == 0 {
+		return 0, nil
+	}
+	keys, err := query.modelKeys(ctx, typ)
+	if err != nil {
+		return
+	}
+	for _, key := range keys {
+		changed, err := query.reencryptKey(ctx, key, fields)
+		if err != nil {
+			return count, fmt.Errorf("reencrypt %s: %w", key, err)
+		}
+		if changed {
+			count++
+		}
+	}
+	return
+}
+
+//reencryptKey 在WATCH中改写单条数据 期间数据被修改时重试
+func (query *Query) reencryptKey(ctx context.Context, key string, fields []string) (changed bool, err error) {
+	id, _, err := query.keyProvider.CurrentKey()
+	if err != nil {
+		return
+	}
+	for retry := 0; retry < 3; retry++ {
+		changed = false
+		err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+			values, err := tx.HMGet(ctx, key, fields...).Result()
+			if err != nil {
+				return err
+			}
+			sealed := map[string]interface{}{}
+			for i, value := range values {
+				data, ok := value.(string)
+				if !ok || isSealedWith(data, id) {
+					continue
+				}
+				aad := encryptAAD(key, fields[i])
+				plain, err := query.open(data, aad)
+				if err != nil {
+					return err
+				}
+				if sealed[fields[i]], err = query.seal(plain, aad); err != nil {
+					return err
+				}
+			}
+			if len(sealed) == 0 {
+				return nil
+			}
+			changed = true
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				return pipe.HSet(ctx, key, sealed).Err()
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			return
+		}
+	}
+	return
+}
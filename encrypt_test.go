@@ -0,0 +1,141 @@
+package rorm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type EncryptTest struct {
+	ID      string `redis:"primary"`
+	Name    string
+	Phone   string   `redis:"encrypt"`
+	History []string `redis:"encrypt;compress:gzip;compressmin:16"`
+}
+
+func TestQuery_Encrypt(t *testing.T) {
+	ctx := context.Background()
+	ring := &KeyRing{Current: "k1", Keys: map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	}}
+	client := NewBFRRedis(NewDefaultOptions(), nil)
+	model := &EncryptTest{ID: "e1", Name: "alice", Phone: "13800000000", History: []string{"a", "b", "c", "d", "e"}}
+
+	err := client.NewQuery().Create(ctx, model)
+	assert.True(t, errors.Is(err, ErrKeyProviderNotSet))
+
+	client.SetKeyProvider(ring)
+	err = client.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/e1"
+	stored, err := client.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", stored["Name"])
+	assert.True(t, isSealedWith(stored["Phone"], "k1"))
+	assert.False(t, strings.Contains(stored["Phone"], model.Phone))
+	assert.True(t, isSealedWith(stored["History"], "k1"))
+
+	result := &EncryptTest{ID: "e1"}
+	err = client.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	//密文复制到其他数据或字段后无法解密
+	other := &EncryptTest{ID: "e2", Phone: "13700000000"}
+	err = client.NewQuery().Create(ctx, other)
+	assert.Nil(t, err)
+	otherKey := GetTypeFullName(other) + "/ID/e2"
+	err = client.client.Do(ctx, "hset", otherKey, "Phone", stored["Phone"]).Err()
+	assert.Nil(t, err)
+	assert.NotNil(t, client.NewQuery().Find(ctx, &EncryptTest{ID: "e2"}))
+	err = client.client.Do(ctx, "hset", otherKey, "Phone", "", "History", stored["Phone"]).Err()
+	assert.Nil(t, err)
+	err = client.client.Do(ctx, "hdel", otherKey, "Phone").Err()
+	assert.Nil(t, err)
+	assert.NotNil(t, client.NewQuery().Find(ctx, &EncryptTest{ID: "e2"}))
+	err = client.NewQuery().Delete(ctx, other)
+	assert.Nil(t, err)
+
+	//明文存储的值只有AllowPlaintext时才能读取
+	err = client.client.Do(ctx, "hset", key, "Phone", "13900000000").Err()
+	assert.Nil(t, err)
+	err = client.NewQuery().Find(ctx, &EncryptTest{ID: "e1"})
+	assert.True(t, errors.Is(err, ErrPlaintextField), err)
+	result = &EncryptTest{ID: "e1"}
+	err = client.NewQuery().AllowPlaintext(true).Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, "13900000000", result.Phone)
+
+	//使用新密钥重新加密 明文存储的旧数据同样加密
+	ring.Current = "k2"
+	_, err = client.NewQuery().Reencrypt(ctx, &EncryptTest{})
+	assert.True(t, errors.Is(err, ErrPlaintextField), err)
+	count, err := client.NewQuery().AllowPlaintext(true).Reencrypt(ctx, &EncryptTest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	stored, err = client.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.True(t, isSealedWith(stored["Phone"], "k2"))
+	assert.True(t, isSealedWith(stored["History"], "k2"))
+
+	count, err = client.NewQuery().Reencrypt(ctx, &EncryptTest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	delete(ring.Keys, "k1")
+	var phones []string
+	err = client.NewQuery().Where(GetTypeFullName(model)+"/ID/e*").Model(&EncryptTest{}).Pluck(ctx, "Phone", &phones)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"13900000000"}, phones)
+
+	//密钥不存在时无法解密
+	delete(ring.Keys, "k2")
+	err = client.NewQuery().Find(ctx, &EncryptTest{ID: "e1"})
+	assert.NotNil(t, err)
+
+	assert.Equal(t, []string{"Phone", "History"}, getEncryptedFields("", reflect.TypeOf(model)))
+}
+
+type EncryptBlobTest struct {
+	ID      string `redis:"primary"`
+	Profile struct {
+		SSN string `redis:"encrypt"`
+	}
+}
+
+func (EncryptBlobTest) RedisLayout() StorageLayout {
+	return BlobLayout
+}
+
+type EncryptIndexTest struct {
+	ID    string `redis:"primary"`
+	Phone string `redis:"encrypt;index"`
+}
+
+func TestQuery_EncryptNotSupported(t *testing.T) {
+	ctx := context.Background()
+	client := NewBFRRedis(NewDefaultOptions(), nil)
+	client.SetKeyProvider(&KeyRing{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}})
+
+	//文档中的字段与索引无法加密 不写入任何数据
+	blob := &EncryptBlobTest{ID: "s"}
+	blob.Profile.SSN = "123-45-6789"
+	err := client.NewQuery().Create(ctx, blob)
+	assert.True(t, errors.Is(err, ErrEncryptNotSupported), err)
+	assert.Contains(t, err.Error(), "Profile.SSN")
+	err = client.NewQuery().Create(ctx, &EncryptIndexTest{ID: "s", Phone: "13800000000"})
+	assert.True(t, errors.Is(err, ErrEncryptNotSupported), err)
+	keys, err := client.NewQuery().scanPatternKeys("*" + escapePattern(GetTypeFullName(&EncryptIndexTest{})) + "*")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+	exists, err := client.client.Exists(ctx, GetTypeFullName(blob)+"/ID/s").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), exists)
+}
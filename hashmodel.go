@@ -0,0 +1,124 @@
+package rorm
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//cmd/rormgen为HASH布局的model生成以下方法 model实现这些接口时
+//Create Find不再通过反射逐个处理字段 Create Find Update Delete不再通过反射得到key
+//Update Updates只使用生成的RedisKey 更新的字段仍然通过反射与字段的Codec编码
+//SubModel(true)与Select时仍然使用反射 索引与版本字段同样通过ModelSchema处理
+
+//HashModel 得到写入HMAP的字段 值为string时直接写入 为nil时从HMAP中删除该字段
+//其他类型的值使用其类型对应的Codec转换
+type HashModel interface {
+	RedisHash() map[string]interface{}
+}
+
+//HashLoader 将HMAP中的数据解析到model中
+type HashLoader interface {
+	FromRedisHash(data map[string]string) error
+}
+
+//KeyModel 得到model的key 格式与redis:"primary"标签使用默认KeyNamer得到的key相同
+//通过SetKeyNamer设置了KeyNamer时不使用RedisKey
+type KeyModel interface {
+	RedisKey() string
+}
+
+//encodeHash 将HashModel的字段分为需要写入的与需要删除的
+func encodeHash(hash map[string]interface{}) (values map[string]interface{}, deleted []string, err error) {
+	values = make(map[string]interface{}, len(hash))
+	for name, value := range hash {
+		switch v := value.(type) {
+		case nil:
+			deleted = append(deleted, name)
+		case string:
+			values[name] = v
+		default:
+			field := reflect.ValueOf(value)
+			data, err := encodeValue(field)
+			if err == errSkipField {
+				if isNilValue(field) {
+					deleted = append(deleted, name)
+				}
+				continue
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			values[name] = data
+		}
+	}
+	return
+}
+
+//pipeHashModel 在pipeline中写入HashModel的字段
+func (query *Query) pipeHashModel(ctx context.Context, pipe redis.Pipeliner, key string, model HashModel) error {
+	values, deleted, err := encodeHash(model.RedisHash())
+	if err != nil {
+		return err
+	}
+	if len(deleted) > 0 {
+		if err = pipe.HDel(ctx, key, deleted...).Err(); err != nil {
+			return err
+		}
+	}
+	if len(values) > 0 {
+		return pipe.HSet(ctx, key, values).Err()
+	}
+	return nil
+}
+
+//以下函数供rormgen生成的代码使用 转换方式与默认的Codec相同
+
+//FormatBool bool存储为1/0
+func FormatBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+//ParseBool 1与true为true
+func ParseBool(data string) bool {
+	return data == "1" || data == "true"
+}
+
+//FormatUnixTime redis:"time:unix"的时间存储为unix纳秒 零值存储为""
+func FormatUnixTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+//ParseTime 解析RFC3339Nano格式或unix纳秒的时间
+func ParseTime(data string) (time.Time, error) {
+	return parseTime(data)
+}
+
+//ParseDuration 解析纳秒或time.ParseDuration格式的时间间隔
+func ParseDuration(data string) (time.Duration, error) {
+	var d time.Duration
+	err := durationCodec{}.Decode(data, reflect.ValueOf(&d).Elem())
+	return d, err
+}
+
+//DecodeValue 使用ptr指向的类型对应的Codec解析data
+func DecodeValue(data string, ptr interface{}) error {
+	if err := decodeValue(data, reflect.ValueOf(ptr).Elem()); err != errSkipField {
+		return err
+	}
+	return nil
+}
+
+//IsZeroValue v是否为零值 用于omitempty
+func IsZeroValue(v interface{}) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
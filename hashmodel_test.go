@@ -0,0 +1,199 @@
+package rorm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type HashModelReflect struct {
+	ID      string `redis:"primary"`
+	Name    string `redis:"name:n;index"`
+	Age     *int
+	Score   float64 `redis:"default:1.5"`
+	Active  bool
+	Born    time.Time `redis:"time:unix"`
+	Tags    []string
+	Comment string `redis:"omitempty"`
+}
+
+//HashModelTest 与HashModelReflect字段相同 方法与rormgen生成的代码相同
+type HashModelTest struct {
+	ID      string `redis:"primary"`
+	Name    string `redis:"name:n;index"`
+	Age     *int
+	Score   float64 `redis:"default:1.5"`
+	Active  bool
+	Born    time.Time `redis:"time:unix"`
+	Tags    []string
+	Comment string `redis:"omitempty"`
+
+	calls map[string]int
+}
+
+func (m *HashModelTest) called(name string) {
+	if m.calls == nil {
+		m.calls = map[string]int{}
+	}
+	m.calls[name]++
+}
+
+func (m *HashModelTest) RedisKey() string {
+	m.called("RedisKey")
+	return ModelName(m) + "/ID/" + EscapeKeyValue(m.ID)
+}
+
+func (m *HashModelTest) RedisHash() map[string]interface{} {
+	m.called("RedisHash")
+	h := make(map[string]interface{}, 8)
+	h["ID"] = m.ID
+	h["n"] = m.Name
+	if m.Age == nil {
+		h["Age"] = nil
+	} else {
+		h["Age"] = strconv.FormatInt(int64(*m.Age), 10)
+	}
+	h["Score"] = strconv.FormatFloat(float64(m.Score), 'f', -1, 64)
+	h["Active"] = FormatBool(m.Active)
+	h["Born"] = FormatUnixTime(m.Born)
+	h["Tags"] = m.Tags
+	if m.Comment == "" {
+		h["Comment"] = nil
+	} else {
+		h["Comment"] = m.Comment
+	}
+	return h
+}
+
+func (m *HashModelTest) FromRedisHash(data map[string]string) error {
+	m.called("FromRedisHash")
+	if value, ok := data["ID"]; ok {
+		m.ID = value
+	}
+	if value, ok := data["n"]; ok {
+		m.Name = value
+	}
+	if value, ok := data["Age"]; ok {
+		v, err := strconv.ParseInt(value, 10, 0)
+		if err != nil {
+			return fmt.Errorf("decode field %s: %w", "Age", err)
+		}
+		x := int(v)
+		m.Age = &x
+	} else {
+		m.Age = nil
+	}
+	{
+		value, ok := data["Score"]
+		if !ok {
+			value = "1.5"
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("decode field %s: %w", "Score", err)
+		}
+		m.Score = float64(v)
+	}
+	if value, ok := data["Active"]; ok {
+		m.Active = ParseBool(value)
+	}
+	if value, ok := data["Born"]; ok {
+		v, err := ParseTime(value)
+		if err != nil {
+			return fmt.Errorf("decode field %s: %w", "Born", err)
+		}
+		m.Born = v
+	}
+	if value, ok := data["Tags"]; ok {
+		if err := DecodeValue(value, &m.Tags); err != nil {
+			return fmt.Errorf("decode field %s: %w", "Tags", err)
+		}
+	}
+	if value, ok := data["Comment"]; ok {
+		m.Comment = value
+	}
+	return nil
+}
+
+func TestQuery_HashModel(t *testing.T) {
+	ctx := context.Background()
+	age := 30
+	born := time.Unix(1600000000, 0)
+	model := &HashModelTest{ID: "h1", Name: "alice", Age: &age, Score: 2.25, Active: true, Born: born, Tags: []string{"a", "b"}}
+	assert.Equal(t, GetTypeFullName(model)+"/ID/h1", model.RedisKey())
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, model.calls["RedisHash"])
+
+	//与反射写入的数据相同
+	err = redisClient.NewQuery().Create(ctx, &HashModelReflect{ID: "h1", Name: "alice", Age: &age, Score: 2.25, Active: true, Born: born, Tags: []string{"a", "b"}})
+	assert.Nil(t, err)
+	generated, err := redisClient.client.HGetAll(ctx, model.RedisKey()).Result()
+	assert.Nil(t, err)
+	reflected, err := redisClient.client.HGetAll(ctx, GetTypeFullName(&HashModelReflect{})+"/ID/h1").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, reflected, generated)
+
+	result := &HashModelTest{ID: "h1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result.calls["FromRedisHash"])
+	result.calls, model.calls = nil, nil
+	assert.Equal(t, model, result)
+
+	//索引仍然由ModelSchema维护
+	var found []HashModelTest
+	err = redisClient.NewQuery().WhereField("Name", "alice").Find(ctx, &found)
+	assert.Nil(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, "h1", found[0].ID)
+	}
+
+	//nil与omitempty的零值从HMAP中删除 没有存储的字段使用默认值
+	err = redisClient.NewQuery().Updates(ctx, model, map[string]interface{}{"Comment": "x"})
+	assert.Nil(t, err)
+	assert.NotZero(t, model.calls["RedisKey"])
+	err = redisClient.NewQuery().Create(ctx, &HashModelTest{ID: "h1", Name: "alice"})
+	assert.Nil(t, err)
+	err = redisClient.client.Do(ctx, "hdel", model.RedisKey(), "Score").Err()
+	assert.Nil(t, err)
+	result = &HashModelTest{ID: "h1", Age: &age}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Age)
+	assert.Equal(t, "", result.Comment)
+	assert.Equal(t, 1.5, result.Score)
+
+	//SubModel与Select时仍然使用反射
+	result = &HashModelTest{ID: "h1"}
+	err = redisClient.NewQuery().Select("n").Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", result.Name)
+	assert.Equal(t, 0, result.calls["FromRedisHash"])
+}
+
+func BenchmarkHashModel(b *testing.B) {
+	ctx := context.Background()
+	age := 30
+	for _, model := range []interface{}{
+		&HashModelReflect{ID: "b1", Name: "bench", Age: &age, Score: 2.25, Tags: []string{"a"}},
+		&HashModelTest{ID: "b1", Name: "bench", Age: &age, Score: 2.25, Tags: []string{"a"}},
+	} {
+		b.Run(fmt.Sprintf("%T", model), func(b *testing.B) {
+			query := redisClient.NewQuery()
+			for i := 0; i < b.N; i++ {
+				if err := query.Create(ctx, model); err != nil {
+					b.Fatal(err)
+				}
+				if err := query.Find(ctx, model); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package rorm
+
+import "context"
+
+//模型实现以下接口时 Create Find Update Updates Delete会自动调用对应的方法
+//Before*返回错误时 不会执行任何redis命令并直接返回该错误
+
+type BeforeCreateHook interface {
+	BeforeCreate(ctx context.Context) error
+}
+
+type AfterCreateHook interface {
+	AfterCreate(ctx context.Context) error
+}
+
+type BeforeUpdateHook interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+type AfterUpdateHook interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+type AfterFindHook interface {
+	AfterFind(ctx context.Context) error
+}
+
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context) error
+}
+
+func callBeforeCreate(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(BeforeCreateHook); ok {
+		return hook.BeforeCreate(ctx)
+	}
+	return nil
+}
+
+func callAfterCreate(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(AfterCreateHook); ok {
+		return hook.AfterCreate(ctx)
+	}
+	return nil
+}
+
+func callBeforeUpdate(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(BeforeUpdateHook); ok {
+		return hook.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+func callAfterUpdate(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(AfterUpdateHook); ok {
+		return hook.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+func callAfterFind(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(AfterFindHook); ok {
+		return hook.AfterFind(ctx)
+	}
+	return nil
+}
+
+func callBeforeDelete(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(BeforeDeleteHook); ok {
+		return hook.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+func callAfterDelete(ctx context.Context, v interface{}) error {
+	if hook, ok := v.(AfterDeleteHook); ok {
+		return hook.AfterDelete(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errHookAbort = errors.New("hook abort")
+
+type HookTest struct {
+	ID      string `redis:"primary"`
+	PayLoad string
+	Calls   []string `redis:"-"`
+}
+
+func (r *HookTest) record(name string) error {
+	r.Calls = append(r.Calls, name)
+	if r.PayLoad == "abort" {
+		return errHookAbort
+	}
+	return nil
+}
+
+func (r *HookTest) BeforeCreate(ctx context.Context) error { return r.record("BeforeCreate") }
+func (r *HookTest) AfterCreate(ctx context.Context) error  { return r.record("AfterCreate") }
+func (r *HookTest) BeforeUpdate(ctx context.Context) error { return r.record("BeforeUpdate") }
+func (r *HookTest) AfterUpdate(ctx context.Context) error  { return r.record("AfterUpdate") }
+func (r *HookTest) AfterFind(ctx context.Context) error    { return r.record("AfterFind") }
+func (r *HookTest) BeforeDelete(ctx context.Context) error { return r.record("BeforeDelete") }
+func (r *HookTest) AfterDelete(ctx context.Context) error  { return r.record("AfterDelete") }
+
+func TestQuery_Hooks(t *testing.T) {
+	ctx := context.Background()
+	redisClient.NewQuery().Delete(ctx, &HookTest{ID: "hook2"})
+
+	tests := []struct {
+		name      string
+		model     *HookTest
+		action    func(model *HookTest) error
+		wantErr   error
+		wantCalls []string
+	}{
+		{
+			name:  "create",
+			model: &HookTest{ID: "hook1", PayLoad: "create"},
+			action: func(model *HookTest) error {
+				return redisClient.NewQuery().Create(ctx, model)
+			},
+			wantCalls: []string{"BeforeCreate", "AfterCreate"},
+		},
+		{
+			name:  "before create abort",
+			model: &HookTest{ID: "hook2", PayLoad: "abort"},
+			action: func(model *HookTest) error {
+				return redisClient.NewQuery().Create(ctx, model)
+			},
+			wantErr:   errHookAbort,
+			wantCalls: []string{"BeforeCreate"},
+		},
+		{
+			name:  "update",
+			model: &HookTest{ID: "hook1"},
+			action: func(model *HookTest) error {
+				return redisClient.NewQuery().Update(ctx, model, "PayLoad", "update")
+			},
+			wantCalls: []string{"BeforeUpdate", "AfterUpdate"},
+		},
+		{
+			name:  "find",
+			model: &HookTest{ID: "hook1"},
+			action: func(model *HookTest) error {
+				return redisClient.NewQuery().Find(ctx, model)
+			},
+			wantCalls: []string{"AfterFind"},
+		},
+		{
+			name:  "delete",
+			model: &HookTest{ID: "hook1"},
+			action: func(model *HookTest) error {
+				return redisClient.NewQuery().Delete(ctx, model)
+			},
+			wantCalls: []string{"BeforeDelete", "AfterDelete"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantErr, tt.action(tt.model))
+			assert.Equal(t, tt.wantCalls, tt.model.Calls)
+		})
+	}
+
+	assert.Equal(t, RormDataNotFound, redisClient.NewQuery().Find(ctx, &HookTest{ID: "hook2"}))
+}
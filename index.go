@@ -0,0 +1,616 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+//索引以redis SET的形式存储 SET中保存的是数据的完整key
+//redis:"index"          单字段索引 索引名即字段名
+//redis:"index:idx_name" 组合索引 所有使用同一个idx_name的字段按定义顺序组成一个索引
+//redis:"index:range"    范围索引 以ZSET存储 score为字段值 支持数值类型与时间类型
+const (
+	indexKeyPrefix = "rorm:index:"
+	rangeIndexName = "range"
+)
+
+type modelIndex struct {
+	Name   string
+	Fields []string
+}
+
+//parsedTags 缓存解析后的redis标签
+var parsedTags sync.Map
+
+//parseRedisTag 解析redis标签 redis:"primary;foreignKey:TESTID" => {"primary":"","foreignKey":"TESTID"}
+//返回的map被缓存 调用方不能修改
+func parseRedisTag(tag string) map[string]string {
+	if settings, ok := parsedTags.Load(tag); ok {
+		return settings.(map[string]string)
+	}
+	settings := map[string]string{}
+	for _, item := range strings.Split(tag, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) == 2 {
+			settings[kv[0]] = kv[1]
+		} else {
+			settings[kv[0]] = ""
+		}
+	}
+	parsedTags.Store(tag, settings)
+	return settings
+}
+
+//getModelIndexes 得到结构体上定义的所有索引
+func getModelIndexes(typ reflect.Type) []*modelIndex {
+	return getSchema(typ).Indexes
+}
+
+//getIndexFields 得到所有被索引的字段名
+func getIndexFields(indexes []*modelIndex) (fields []string) {
+	exists := map[string]bool{}
+	for _, index := range indexes {
+		for _, field := range index.Fields {
+			if !exists[field] {
+				exists[field] = true
+				fields = append(fields, field)
+			}
+		}
+	}
+	return
+}
+
+func (index *modelIndex) hasField(fieldName string) bool {
+	for _, field := range index.Fields {
+		if field == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+//key 得到索引值对应的SET的key 任何一个字段没有值时返回""
+func (index *modelIndex) key(namer KeyNamer, typ reflect.Type, data map[string]string) string {
+	values := make([]string, 0, len(index.Fields))
+	for _, field := range index.Fields {
+		value, ok := data[field]
+		if !ok {
+			return ""
+		}
+		values = append(values, value)
+	}
+	return namer.IndexKey(getSchema(typ).Name, index.Name, values)
+}
+
+//formatIndexValue 将字段值转换为索引中的字符串形式 无法存储的值返回""
+//与写入HSET时一样使用字段标签对应的Codec 例如 redis:"time:unix" 但不压缩
+func formatIndexValue(sf reflect.StructField, value reflect.Value) string {
+	data, err := encodeIndexValue(sf, value)
+	if err != nil {
+		return ""
+	}
+	return data
+}
+
+func encodeIndexValue(sf reflect.StructField, value reflect.Value) (string, error) {
+	if !value.IsValid() {
+		return "", errSkipField
+	}
+	return valueCodec(sf, value.Type()).Encode(value)
+}
+
+//storedIndexValue 将HMAP中存储的值转换为索引中的形式 压缩的值先解压
+func storedIndexValue(field *SchemaField, stored string) (string, bool) {
+	value := reflect.New(field.Type).Elem()
+	if err := field.decode(stored, value); err != nil {
+		return "", false
+	}
+	data, err := encodeIndexValue(field.StructField, value)
+	return data, err == nil
+}
+
+//indexStructField 得到被索引的字段的定义 字段不存在时返回零值 使用值类型默认的Codec
+func indexStructField(typ reflect.Type, name string) reflect.StructField {
+	if field, ok := getSchema(typ).byName[name]; ok {
+		return field.StructField
+	}
+	return reflect.StructField{}
+}
+
+//getStoredIndexData 读取redis中已存储的索引字段值 更新时需要在WATCH hashKey之后调用 保证写入前旧值未被修改
+func (query *Query) getStoredIndexData(ctx context.Context, hashKey string, typ reflect.Type, fields []string) (data map[string]string, err error) {
+	data = map[string]string{}
+	if len(fields) == 0 {
+		return
+	}
+	if getLayout(typ) != HashLayout {
+		document, err := query.readDocument(ctx, hashKey, typ)
+		if err != nil || !document.IsValid() {
+			return data, err
+		}
+		for _, field := range fields {
+			value, ok := fieldByName(document, field, false)
+			if !ok {
+				continue
+			}
+			if value, err := encodeIndexValue(indexStructField(typ, field), value); err == nil {
+				data[field] = value
+			}
+		}
+		return data, nil
+	}
+	stored := make([]string, 0, len(fields))
+	for _, field := range fields {
+		stored = append(stored, storedFieldName(typ, field))
+	}
+	values, err := query.client.HMGet(ctx, hashKey, stored...).Result()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		field, ok := getSchema(typ).byName[fields[i]]
+		if !ok {
+			continue
+		}
+		if str, ok = storedIndexValue(field, str); ok {
+			data[fields[i]] = str
+		}
+	}
+	return data, nil
+}
+
+//pipeIndexes 在pipeline中更新索引 oldData为redis中已存储的值 newData为本次写入的值
+func (query *Query) pipeIndexes(ctx context.Context, pipe redis.Pipeliner, hashKey string, typ reflect.Type, indexes []*modelIndex, oldData, newData map[string]string) {
+	merged := map[string]string{}
+	for field, value := range oldData {
+		merged[field] = value
+	}
+	for field, value := range newData {
+		merged[field] = value
+	}
+
+	for _, index := range indexes {
+		changed := false
+		for field := range newData {
+			if index.hasField(field) {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			continue
+		}
+		oldKey := index.key(query.namer(), typ, oldData)
+		newKey := index.key(query.namer(), typ, merged)
+		if oldKey == newKey {
+			continue
+		}
+		if oldKey != "" {
+			pipe.SRem(ctx, oldKey, hashKey)
+		}
+		if newKey != "" {
+			pipe.SAdd(ctx, newKey, hashKey)
+		}
+	}
+}
+
+//pipeUpdateIndexes 读取旧的索引值并在pipeline中写入新的索引 newData为要写入的字段值
+func (query *Query) pipeUpdateIndexes(ctx context.Context, pipe redis.Pipeliner, hashKey string, model interface{}, newData map[string]reflect.Value) (err error) {
+	typ := reflect.TypeOf(model)
+
+	for _, field := range getRangeIndexFields(typ) {
+		value, ok := newData[field]
+		if !ok {
+			continue
+		}
+		if isNilValue(value) {
+			pipe.ZRem(ctx, query.rangeIndexKey(typ, field), hashKey)
+			continue
+		}
+		score, err := rangeScore(value)
+		if err != nil {
+			return err
+		}
+		pipe.ZAdd(ctx, query.rangeIndexKey(typ, field), &redis.Z{Score: score, Member: hashKey})
+	}
+
+	indexes := getModelIndexes(typ)
+	if len(indexes) == 0 {
+		return
+	}
+
+	indexData := map[string]string{}
+	for _, field := range getIndexFields(indexes) {
+		if value, ok := newData[field]; ok {
+			indexData[field] = formatIndexValue(indexStructField(typ, field), value)
+		}
+	}
+	if len(indexData) == 0 {
+		return
+	}
+
+	oldData, err := query.getStoredIndexData(ctx, hashKey, typ, getIndexFields(indexes))
+	if err != nil {
+		return
+	}
+	query.pipeIndexes(ctx, pipe, hashKey, typ, indexes, oldData, indexData)
+	return
+}
+
+//pipeDeleteIndexes 在pipeline中将hashKey从所有索引中移除
+func (query *Query) pipeDeleteIndexes(ctx context.Context, pipe redis.Pipeliner, hashKey string, model interface{}) (err error) {
+	typ := reflect.TypeOf(model)
+
+	for _, field := range getRangeIndexFields(typ) {
+		pipe.ZRem(ctx, query.rangeIndexKey(typ, field), hashKey)
+	}
+
+	indexes := getModelIndexes(typ)
+	if len(indexes) == 0 {
+		return
+	}
+
+	oldData, err := query.getStoredIndexData(ctx, hashKey, typ, getIndexFields(indexes))
+	if err != nil {
+		return
+	}
+	for _, index := range indexes {
+		if key := index.key(query.namer(), typ, oldData); key != "" {
+			pipe.SRem(ctx, key, hashKey)
+		}
+	}
+	return
+}
+
+//findIndexKeys 根据WhereField设置的条件从索引中找到满足条件的数据key
+//条件字段恰好组成一个组合索引时使用该组合索引 否则每个条件都需要有对应的单字段索引 结果取交集
+func (query *Query) findIndexKeys(ctx context.Context, typ reflect.Type) (keys []string, err error) {
+	indexes := getModelIndexes(typ)
+
+	conditions := map[string]string{}
+	for field, value := range query.WhereValues {
+		conditions[field] = formatIndexValue(indexStructField(typ, field), reflect.ValueOf(value))
+	}
+
+	for _, index := range indexes {
+		if len(index.Fields) != len(conditions) {
+			continue
+		}
+		if key := index.key(query.namer(), typ, conditions); key != "" {
+			return query.client.SMembers(ctx, key).Result()
+		}
+	}
+
+	var result map[string]bool
+	for field := range conditions {
+		var found *modelIndex
+		for _, index := range indexes {
+			if len(index.Fields) == 1 && index.Fields[0] == field {
+				found = index
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("%w: no index for field %s", RormIndexNotFound, field)
+		}
+
+		members, err := query.client.SMembers(ctx, found.key(query.namer(), typ, conditions)).Result()
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]bool{}
+		for _, member := range members {
+			if result == nil || result[member] {
+				current[member] = true
+			}
+		}
+		result = current
+	}
+
+	for key := range result {
+		keys = append(keys, key)
+	}
+	return
+}
+
+//getRangeIndexFields 得到所有定义了范围索引的字段名
+func getRangeIndexFields(typ reflect.Type) []string {
+	return getSchema(typ).RangeFields
+}
+
+func hasRangeIndex(typ reflect.Type, fieldName string) bool {
+	for _, field := range getRangeIndexFields(typ) {
+		if field == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+func (query *Query) rangeIndexKey(typ reflect.Type, fieldName string) string {
+	return query.namer().IndexKey(getSchema(typ).Name, fieldName, []string{rangeIndexName})
+}
+
+func isNilValue(value reflect.Value) bool {
+	if !value.IsValid() {
+		return true
+	}
+	return isNilable(value) && value.IsNil()
+}
+
+//isNilable 值可以为nil的指针与接口
+func isNilable(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+//rangeScore 将字段值转换为ZSET的score 时间类型使用unix毫秒
+func rangeScore(value reflect.Value) (score float64, err error) {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			err = RormRangeNotSupported
+			return
+		}
+		value = value.Elem()
+	}
+	if t, ok := value.Interface().(interface{ UnixNano() int64 }); ok {
+		return float64(t.UnixNano() / int64(time.Millisecond)), nil
+	}
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		score = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		score = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		score = value.Float()
+	case reflect.Bool:
+		if value.Bool() {
+			score = 1
+		}
+	default:
+		err = RormRangeNotSupported
+	}
+	return
+}
+
+//formatRangeBound 将Range的边界转换为ZRANGEBYSCORE的参数 nil表示不限制
+func formatRangeBound(bound interface{}, inf string) (string, error) {
+	if bound == nil {
+		return inf, nil
+	}
+	score, err := rangeScore(reflect.ValueOf(bound))
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64), nil
+}
+
+//zRangeKeys 从范围索引中按score顺序取出key useBound为false时不使用Range设置的边界
+func (query *Query) zRangeKeys(ctx context.Context, typ reflect.Type, fieldName string, desc bool, useBound bool, offset, count int64) (keys []string, err error) {
+	if !hasRangeIndex(typ, fieldName) {
+		return nil, fmt.Errorf("%w: no range index for field %s", RormIndexNotFound, fieldName)
+	}
+
+	opt := &redis.ZRangeBy{Min: "-inf", Max: "+inf", Offset: offset, Count: count}
+	if useBound {
+		if opt.Min, err = formatRangeBound(query.RangeMin, "-inf"); err != nil {
+			return
+		}
+		if opt.Max, err = formatRangeBound(query.RangeMax, "+inf"); err != nil {
+			return
+		}
+	}
+	if opt.Offset > 0 && opt.Count == 0 {
+		opt.Count = -1
+	}
+
+	key := query.rangeIndexKey(typ, fieldName)
+	if desc {
+		return query.client.ZRevRangeByScore(ctx, key, opt).Result()
+	}
+	return query.client.ZRangeByScore(ctx, key, opt).Result()
+}
+
+//modelKeys 得到满足条件的数据key 没有Where WhereField等条件时遍历model的所有数据
+func (query *Query) modelKeys(ctx context.Context, typ reflect.Type) ([]string, error) {
+	if query.Pattern == "" && len(query.WhereValues) == 0 && query.OrderField == "" && query.RangeField == "" {
+		return query.scanPatternKeys(escapePattern(query.namer().Prefix(getSchema(typ).Name)) + "*")
+	}
+	return query.findKeys(ctx, typ)
+}
+
+//findKeys 根据WhereField Range OrderBy Limit Offset得到有序的数据key 同时设置了Where时只保留与模式匹配的key
+func (query *Query) findKeys(ctx context.Context, typ reflect.Type) (keys []string, err error) {
+	orderField := query.OrderField
+	desc := query.OrderDesc
+	if orderField == "" {
+		orderField = query.RangeField
+		desc = false
+	}
+
+	if orderField == "" {
+		if len(query.WhereValues) > 0 {
+			if keys, err = query.findIndexKeys(ctx, typ); err == nil {
+				keys = query.filterPattern(keys)
+			}
+		} else {
+			if query.Pattern == "" {
+				return nil, errors.New(`Query Pattern can not be ""`)
+			}
+			keys, err = query.scanPatternKeys(query.scanPattern())
+		}
+		if err != nil {
+			return
+		}
+		return query.paginate(keys), nil
+	}
+
+	var filters []map[string]bool
+	if query.RangeField != "" && query.RangeField != orderField {
+		rangeKeys, err := query.zRangeKeys(ctx, typ, query.RangeField, false, true, 0, 0)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, toKeySet(rangeKeys))
+	}
+	if len(query.WhereValues) > 0 {
+		indexKeys, err := query.findIndexKeys(ctx, typ)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, toKeySet(indexKeys))
+	}
+
+	useBound := query.RangeField == orderField
+	if len(filters) == 0 && query.Pattern == "" {
+		//没有其他过滤条件时直接由redis分页
+		return query.zRangeKeys(ctx, typ, orderField, desc, useBound, query.OffsetValue, query.LimitValue)
+	}
+
+	sortedKeys, err := query.zRangeKeys(ctx, typ, orderField, desc, useBound, 0, 0)
+	if err != nil {
+		return
+	}
+	for _, key := range sortedKeys {
+		matched := true
+		for _, filter := range filters {
+			if !filter[key] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			keys = append(keys, key)
+		}
+	}
+	return query.paginate(query.filterPattern(keys)), nil
+}
+
+//filterPattern 只保留与Where设置的模式匹配的key 没有设置模式时原样返回
+func (query *Query) filterPattern(keys []string) []string {
+	if query.Pattern == "" {
+		return keys
+	}
+	pattern := query.scanPattern()
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if matchGlob(pattern, key) {
+			matched = append(matched, key)
+		}
+	}
+	return matched
+}
+
+//paginate 按Offset Limit截取keys
+func (query *Query) paginate(keys []string) []string {
+	if query.OffsetValue > 0 {
+		if query.OffsetValue >= int64(len(keys)) {
+			return []string{}
+		}
+		keys = keys[query.OffsetValue:]
+	}
+	if query.LimitValue > 0 && query.LimitValue < int64(len(keys)) {
+		keys = keys[:query.LimitValue]
+	}
+	return keys
+}
+
+func toKeySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		set[key] = true
+	}
+	return set
+}
+
+//matchGlob 与redis SCAN MATCH相同的模式匹配 支持* ? [abc] [^abc] [a-z]与\转义
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					match = match || pattern[0] == s[0]
+				case len(pattern) >= 3 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					match = match || (s[0] >= lo && s[0] <= hi)
+					pattern = pattern[2:]
+				default:
+					match = match || pattern[0] == s[0]
+				}
+				pattern = pattern[1:]
+			}
+			if match == not {
+				return false
+			}
+			s = s[1:]
+			if len(pattern) == 0 {
+				//没有闭合的[与redis相同 匹配到模式结束
+				return len(s) == 0
+			}
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
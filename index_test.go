@@ -0,0 +1,277 @@
+package rorm
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type IndexTest struct {
+	ID     string `redis:"primary"`
+	TESTID string `redis:"index"`
+	Group  string `redis:"index:group_level"`
+	Level  int    `redis:"index:group_level"`
+	Online bool   `redis:"index"`
+}
+
+func TestQuery_WhereField(t *testing.T) {
+	ctx := context.Background()
+	models := []*IndexTest{
+		{ID: "index1", TESTID: "inner1", Group: "a", Level: 1, Online: true},
+		{ID: "index2", TESTID: "inner1", Group: "a", Level: 2, Online: false},
+		{ID: "index3", TESTID: "inner2", Group: "a", Level: 1, Online: true},
+	}
+	for _, model := range models {
+		if err := redisClient.NewQuery().Create(ctx, model); err != nil {
+			t.Fatalf("Query.Create() error = %v", err)
+		}
+	}
+	if err := redisClient.NewQuery().Update(ctx, &IndexTest{ID: "index3"}, "TESTID", "inner1"); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+	if err := redisClient.NewQuery().Delete(ctx, &IndexTest{ID: "index2"}); err != nil {
+		t.Fatalf("Query.Delete() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   *Query
+		wantIDs []string
+		wantErr bool
+	}{
+		{
+			name:    "single field index",
+			query:   redisClient.NewQuery().WhereField("TESTID", "inner1"),
+			wantIDs: []string{"index1", "index3"},
+		},
+		{
+			name:    "old value removed from index",
+			query:   redisClient.NewQuery().WhereField("TESTID", "inner2"),
+			wantIDs: []string{},
+		},
+		{
+			name:    "composite index",
+			query:   redisClient.NewQuery().WhereField("Group", "a").WhereField("Level", 1),
+			wantIDs: []string{"index1", "index3"},
+		},
+		{
+			name:    "intersect single field indexes",
+			query:   redisClient.NewQuery().WhereField("TESTID", "inner1").WhereField("Online", true),
+			wantIDs: []string{"index1", "index3"},
+		},
+		{
+			name:    "where pattern with field index",
+			query:   redisClient.NewQuery().Where("*IndexTest/ID/index3").WhereField("TESTID", "inner1"),
+			wantIDs: []string{"index3"},
+		},
+		{
+			name:    "field without index",
+			query:   redisClient.NewQuery().WhereField("ID", "index1"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := []IndexTest{}
+			if err := tt.query.Find(ctx, &result); (err != nil) != tt.wantErr {
+				t.Errorf("Query.Find() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr {
+				ids := []string{}
+				for _, data := range result {
+					ids = append(ids, data.ID)
+				}
+				sort.Strings(ids)
+				assert.Equal(t, tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+type ConcurrentIndexTest struct {
+	ID  string `redis:"primary"`
+	Tag string `redis:"index"`
+}
+
+//interleaveClient 在第一次HMGET之后执行interleave 模拟读取旧索引值与写入之间的并发更新
+type interleaveClient struct {
+	Redisclient
+	interleave func()
+}
+
+func (c *interleaveClient) HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd {
+	cmd := c.Redisclient.HMGet(ctx, key, fields...)
+	if interleave := c.interleave; interleave != nil {
+		c.interleave = nil
+		interleave()
+	}
+	return cmd
+}
+
+func TestQuery_UpdateIndexConcurrent(t *testing.T) {
+	ctx := context.Background()
+	clearModelKeys(t, "ConcurrentIndexTest")
+	if err := redisClient.NewQuery().Create(ctx, &ConcurrentIndexTest{ID: "concurrent", Tag: "tag0"}); err != nil {
+		t.Fatalf("Query.Create() error = %v", err)
+	}
+
+	query := redisClient.NewQuery()
+	query.client = &interleaveClient{Redisclient: query.client, interleave: func() {
+		if err := redisClient.NewQuery().Update(ctx, &ConcurrentIndexTest{ID: "concurrent"}, "Tag", "tag1"); err != nil {
+			t.Errorf("Query.Update() error = %v", err)
+		}
+	}}
+	if err := query.Update(ctx, &ConcurrentIndexTest{ID: "concurrent"}, "Tag", "tag2"); err != nil {
+		t.Fatalf("Query.Update() error = %v", err)
+	}
+
+	for tag, want := range map[string]int{"tag0": 0, "tag1": 0, "tag2": 1} {
+		result := []ConcurrentIndexTest{}
+		if err := redisClient.NewQuery().WhereField("Tag", tag).Find(ctx, &result); err != nil {
+			t.Fatalf("Query.Find() error = %v", err)
+		}
+		assert.Equal(t, want, len(result), tag)
+	}
+}
+
+type RangeTest struct {
+	ID        string    `redis:"primary"`
+	TEST2     float64   `redis:"index:range"`
+	CreatedAt time.Time `redis:"index:range"`
+	TESTID    string    `redis:"index"`
+}
+
+func TestQuery_Range(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	models := []*RangeTest{
+		{ID: "range1", TEST2: 1.0, CreatedAt: now.Add(-2 * time.Hour), TESTID: "inner1"},
+		{ID: "range2", TEST2: 1.5, CreatedAt: now.Add(-30 * time.Minute), TESTID: "inner2"},
+		{ID: "range3", TEST2: 2.5, CreatedAt: now.Add(-20 * time.Minute), TESTID: "inner1"},
+		{ID: "range4", TEST2: 3.0, CreatedAt: now.Add(-10 * time.Minute), TESTID: "inner1"},
+		{ID: "range5", TEST2: 3.5, CreatedAt: now, TESTID: "inner1"},
+	}
+	for _, model := range models {
+		if err := redisClient.NewQuery().Create(ctx, model); err != nil {
+			t.Fatalf("Query.Create() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		query   *Query
+		wantIDs []string
+		wantErr bool
+	}{
+		{
+			name:    "range between",
+			query:   redisClient.NewQuery().Range("TEST2", 1.5, 3.0),
+			wantIDs: []string{"range2", "range3", "range4"},
+		},
+		{
+			name:    "range time in last hour order desc",
+			query:   redisClient.NewQuery().Range("CreatedAt", now.Add(-time.Hour), nil).OrderBy("CreatedAt", true),
+			wantIDs: []string{"range5", "range4", "range3", "range2"},
+		},
+		{
+			name:    "order with limit offset",
+			query:   redisClient.NewQuery().OrderBy("TEST2", true).Offset(1).Limit(2),
+			wantIDs: []string{"range4", "range3"},
+		},
+		{
+			name:    "range with where field",
+			query:   redisClient.NewQuery().WhereField("TESTID", "inner1").Range("TEST2", 1.5, nil).OrderBy("CreatedAt", false).Limit(2),
+			wantIDs: []string{"range3", "range4"},
+		},
+		{
+			name:    "where pattern with order limit",
+			query:   redisClient.NewQuery().Where("*RangeTest/ID/range[2-4]").OrderBy("TEST2", true).Limit(2),
+			wantIDs: []string{"range4", "range3"},
+		},
+		{
+			name:    "where pattern with range",
+			query:   redisClient.NewQuery().Where("*RangeTest/ID/range[^3]").Range("TEST2", 1.5, 3.0),
+			wantIDs: []string{"range2", "range4"},
+		},
+		{
+			name:    "range on field without range index",
+			query:   redisClient.NewQuery().Range("TESTID", 1, 2),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := []*RangeTest{}
+			if err := tt.query.Find(ctx, &result); (err != nil) != tt.wantErr {
+				t.Errorf("Query.Find() error = %v, wantErr %v", err, tt.wantErr)
+			} else if !tt.wantErr {
+				ids := []string{}
+				for _, data := range result {
+					ids = append(ids, data.ID)
+				}
+				assert.Equal(t, tt.wantIDs, ids)
+			}
+		})
+	}
+}
+
+func Test_matchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"*", "", true},
+		{"a*c", "a/b/c", true},
+		{"a*c", "a/b/d", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a[bc]d", "acd", true},
+		{"a[^bc]d", "acd", false},
+		{"a[^bc]d", "aed", true},
+		{"a[b-d]e", "ace", true},
+		{"a[d-b]e", "ace", true},
+		{"a[b-d]e", "aee", false},
+		{"a[\\]]b", "a]b", true},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "axb", false},
+		{"a[bc", "ab", true},
+		{"**x", "yx", true},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchGlob(tt.pattern, tt.key), "matchGlob(%q, %q)", tt.pattern, tt.key)
+	}
+}
+
+type IndexCodecTest struct {
+	ID string    `redis:"primary"`
+	At time.Time `redis:"index;time:unix"`
+}
+
+func TestQuery_WhereFieldCodec(t *testing.T) {
+	ctx := context.Background()
+	t1, t2 := time.Unix(1600000000, 0), time.Unix(1700000000, 0)
+	err := redisClient.NewQuery().Create(ctx, &IndexCodecTest{ID: "c1", At: t1})
+	assert.Nil(t, err)
+	key := indexKeyPrefix + GetTypeFullName(&IndexCodecTest{}) + "/At/" + strconv.FormatInt(t1.UnixNano(), 10)
+	exists, err := redisClient.client.Exists(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), exists)
+
+	//更新后旧的索引值被移除
+	err = redisClient.NewQuery().Update(ctx, &IndexCodecTest{ID: "c1"}, "At", t2)
+	assert.Nil(t, err)
+	var found []IndexCodecTest
+	err = redisClient.NewQuery().WhereField("At", t1).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+	err = redisClient.NewQuery().WhereField("At", t2).Find(ctx, &found)
+	assert.Nil(t, err)
+	if assert.Len(t, found, 1) {
+		assert.True(t, t2.Equal(found[0].At))
+	}
+}
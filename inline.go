@@ -0,0 +1,203 @@
+package rorm
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//inline 标签 redis:"inline" 的结构体字段不单独存储 而是展开为以.连接的字段名存储在父结构体的HMAP中
+//例如 Address Address `redis:"inline"` 存储为 Address.City Address.Zip 嵌套的inline结构体递归展开
+
+//isInline 字段是否使用inline方式存储
+func isInline(sf reflect.StructField) bool {
+	_, ok := parseRedisTag(sf.Tag.Get("redis"))["inline"]
+	return ok
+}
+
+//inlineName 得到展开后的字段名
+func inlineName(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+//fieldFunc 处理展开后的单个字段 schemaField为该字段解析后的定义 用于确定其Codec与标签
+type fieldFunc func(name string, schemaField *SchemaField, field reflect.Value) error
+
+//walkFields 遍历结构体中需要存储的字段 inline字段展开后逐个调用fn
+//nil的匿名指针中的字段以无效的Value调用fn
+func walkFields(prefix string, val reflect.Value, fn fieldFunc) error {
+	for _, field := range getSchema(val.Type()).Fields {
+		if err := walkField(inlineName(prefix, field.Stored), field, fieldByIndex(val, field.Index, false), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//walkField 对单个字段调用fn 字段为inline结构体时展开
+//nil的inline指针中的所有字段以无效的Value调用fn 使已存储的字段被删除
+func walkField(name string, schemaField *SchemaField, field reflect.Value, fn fieldFunc) error {
+	if !schemaField.inline {
+		return fn(name, schemaField, field)
+	}
+	for field.IsValid() && field.Kind() == reflect.Ptr && !field.IsNil() {
+		field = field.Elem()
+	}
+	if !field.IsValid() || field.Kind() == reflect.Ptr {
+		return walkNil(name, schemaField, map[reflect.Type]bool{}, fn)
+	}
+	if field.Kind() != reflect.Struct {
+		return fn(name, schemaField, field)
+	}
+	return walkFields(name, field, fn)
+}
+
+//walkNil 以无效的Value对inline字段展开后的所有字段调用fn 自身嵌套的类型只展开一层
+func walkNil(name string, schemaField *SchemaField, visited map[reflect.Type]bool, fn fieldFunc) error {
+	typ := schemaField.Type
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if !schemaField.inline || typ.Kind() != reflect.Struct {
+		return fn(name, schemaField, reflect.Value{})
+	}
+	if visited[typ] {
+		return nil
+	}
+	visited[typ] = true
+	defer delete(visited, typ)
+	for _, field := range getSchema(typ).Fields {
+		if err := walkNil(inlineName(name, field.Stored), field, visited, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//modelField 字段名对应的结构体字段
+type modelField struct {
+	sf     *SchemaField
+	name   string //Go中的字段名 inline结构体中的字段为Address.City
+	stored string //存储在HMAP中的字段名
+}
+
+//lookupField 根据字段名得到结构体字段 支持通过Address.City的形式访问inline结构体中的字段
+//每一级可以使用Go中的字段名或者redis:"name:"指定的名称
+func lookupField(typ reflect.Type, name string) (field modelField, ok bool) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if typ.Kind() != reflect.Struct {
+			return field, false
+		}
+		sf, found := getSchema(typ).lookup(part)
+		if !found {
+			return field, false
+		}
+		field.sf = sf
+		field.name = inlineName(field.name, sf.Name)
+		field.stored = inlineName(field.stored, sf.Stored)
+		if i < len(parts)-1 {
+			if !sf.inline {
+				return field, false
+			}
+			typ = sf.Type
+			for typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+		}
+	}
+	return field, true
+}
+
+//decodeFields 将data中以prefix开头的字段解析到结构体val中 inline字段递归解析
+//nil的匿名指针只有在存储了其中的字段时才会创建
+func (query *Query) decodeFields(hashKey string, prefix string, data map[string]string, val reflect.Value) (err error) {
+	for _, schemaField := range getSchema(val.Type()).Fields {
+		name := inlineName(prefix, schemaField.Stored)
+		field := fieldByIndex(val, schemaField.Index, false)
+		if schemaField.inline {
+			if !field.IsValid() {
+				if _, ok := data[name]; !ok && !hasInlineData(name, data) {
+					continue
+				}
+				field = fieldByIndex(val, schemaField.Index, true)
+			}
+			if err = query.decodeInline(hashKey, name, schemaField, data, field); err != nil {
+				return
+			}
+			continue
+		}
+
+		value, ok := data[name]
+		if ok {
+			if value, err = query.openField(hashKey, name, value, schemaField); err != nil {
+				return
+			}
+		} else {
+			//没有存储该字段时使用默认值 Select时未选择的字段不使用默认值
+			if len(query.SelectValues) > 0 {
+				continue
+			}
+			if value, ok = schemaField.defaultValue, schemaField.hasDefault; !ok {
+				//没有存储的指针字段为nil
+				if isNilable(field) && schemaField.ForeignKey == "" && field.CanSet() {
+					field.Set(reflect.Zero(field.Type()))
+				}
+				continue
+			}
+		}
+		if !field.IsValid() {
+			field = fieldByIndex(val, schemaField.Index, true)
+		}
+		if !field.IsValid() || !field.CanSet() {
+			return fmt.Errorf("field %s can not be set", name)
+		}
+		if err = decodePlainField(name, value, schemaField, field); err != nil {
+			return
+		}
+	}
+	return
+}
+
+//decodeInline 解析inline结构体字段 指针字段只有在存储了其中的字段时才会创建
+func (query *Query) decodeInline(hashKey string, name string, schemaField *SchemaField, data map[string]string, field reflect.Value) error {
+	switch field.Kind() {
+	case reflect.Struct:
+		return query.decodeFields(hashKey, name, data, field)
+	case reflect.Ptr:
+		if _, ok := data[name]; !ok && !hasInlineData(name, data) {
+			//没有存储其中的字段时为nil Select时未选择的字段不修改
+			if len(query.SelectValues) == 0 && field.CanSet() {
+				field.Set(reflect.Zero(field.Type()))
+			}
+			return nil
+		}
+		ptr := reflect.New(field.Type().Elem())
+		if err := query.decodeInline(hashKey, name, schemaField, data, ptr.Elem()); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	default:
+		if value, ok := data[name]; ok {
+			return query.decodeField(hashKey, name, value, schemaField, field)
+		}
+		return nil
+	}
+}
+
+func hasInlineData(name string, data map[string]string) bool {
+	prefix := name + "."
+	for key := range data {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package rorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type InlineGeo struct {
+	Lat float64
+	Lng float64
+}
+
+type InlineAddress struct {
+	City string
+	Zip  int
+	Geo  InlineGeo `redis:"inline"`
+}
+
+type InlineTest struct {
+	ID      string         `redis:"primary"`
+	Address InlineAddress  `redis:"inline"`
+	Billing *InlineAddress `redis:"inline"`
+}
+
+func TestQuery_Inline(t *testing.T) {
+	ctx := context.Background()
+	model := &InlineTest{
+		ID:      "inline1",
+		Address: InlineAddress{City: "Shanghai", Zip: 200000, Geo: InlineGeo{Lat: 31.2, Lng: 121.5}},
+	}
+	assert.Equal(t, map[string]string{
+		"ID":              "inline1",
+		"Address.City":    "Shanghai",
+		"Address.Zip":     "200000",
+		"Address.Geo.Lat": "31.2",
+		"Address.Geo.Lng": "121.5",
+	}, ConvertStructToMap(model))
+
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/inline1"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "Shanghai", stored["Address.City"])
+	assert.Equal(t, "121.5", stored["Address.Geo.Lng"])
+	_, ok := stored["Address"]
+	assert.False(t, ok)
+
+	result := &InlineTest{ID: "inline1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+	assert.Nil(t, result.Billing)
+
+	//整体更新inline结构体
+	billing := InlineAddress{City: "Beijing", Zip: 100000}
+	err = redisClient.NewQuery().Update(ctx, &InlineTest{ID: "inline1"}, "Billing", billing)
+	assert.Nil(t, err)
+	//更新inline结构体中的单个字段
+	err = redisClient.NewQuery().Update(ctx, &InlineTest{ID: "inline1"}, "Address.Geo.Lat", 30.0)
+	assert.Nil(t, err)
+	err = redisClient.NewQuery().Update(ctx, &InlineTest{ID: "inline1"}, "Address.Country", "CN")
+	assert.Equal(t, RormFieldNotExist, err)
+
+	result = &InlineTest{ID: "inline1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, &billing, result.Billing)
+	assert.Equal(t, 30.0, result.Address.Geo.Lat)
+
+	var cities []string
+	err = redisClient.NewQuery().Where(GetTypeFullName(model)+"/ID/inline*").Model(&InlineTest{}).Pluck(ctx, "Billing.City", &cities)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Beijing"}, cities)
+}
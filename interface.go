@@ -12,8 +12,13 @@ var (
 	RormPTRNeed            = errors.New("pointer parameter need")
 	RormDataNotFound       = errors.New("no data found")
 	RormModelMustBeStruct  = errors.New("model must be struct type")
+	RormModelMustBeSlice   = errors.New("models must be slice type")
 	RormFieldNotExist      = errors.New("field not exists in struct")
 	RormPrimaryKeyNotFound = errors.New("struct need have one primary key not found")
+	RormIndexNotFound      = errors.New("index not found for field")
+	RormRangeNotSupported  = errors.New("range index only support number and time field")
+	RormInvalidCursor      = errors.New("invalid cursor")
+	ErrDuplicateKey        = errors.New("record with the same primary key already exists")
 )
 
 // type Redis interface {
@@ -25,6 +30,14 @@ var (
 
 type OrmQuery interface {
 	Where(pattern string) *Query
+	WhereField(fieldName string, v interface{}) *Query
+	Range(fieldName string, min, max interface{}) *Query
+	OrderBy(fieldName string, desc bool) *Query
+	Mode(mode WriteMode) *Query
+	Limit(n int64) *Query
+	Cursor(cursor string) *Query
+	Offset(n int64) *Query
+	Model(model interface{}) *Query
 	SubModel(flag bool) *Query
 	Expire(d int64) *Query
 }
@@ -34,10 +47,12 @@ type RormLoader interface {
 	Loader(v interface{}) error
 }
 
+//Valuer 字段实现Valuer时 写入RedisValue返回的字符串 优先于encoding.TextMarshaler等标准接口
 type Valuer interface {
 	RedisValue() string
 }
 
+//Scanner 字段的指针实现Scanner时 读取时调用RedisScan src为存储的[]byte
 type Scanner interface {
 	RedisScan(src interface{}) error
 }
@@ -64,6 +79,11 @@ type Redisclient interface {
 	Pipeline() redis.Pipeliner
 	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
 	HGetAll(context.Context, string) *redis.StringStringMapCmd
+	HMGet(ctx context.Context, key string, fields ...string) *redis.SliceCmd
+	SMembers(ctx context.Context, key string) *redis.StringSliceCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRevRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZCount(ctx context.Context, key, min, max string) *redis.IntCmd
 	SetNX(context.Context, string, interface{}, time.Duration) *redis.BoolCmd
 	Exists(ctx context.Context, keys ...string) *redis.IntCmd
 	Eval(ctx context.Context, script string, keys []string, args ...interface{}) *redis.Cmd
@@ -72,4 +92,6 @@ type Redisclient interface {
 	ScriptLoad(ctx context.Context, script string) *redis.StringCmd
 	Publish(ctx context.Context, channel string, message interface{}) *redis.IntCmd
 	Subscribe(ctx context.Context, channels ...string) *redis.PubSub
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+	Do(ctx context.Context, args ...interface{}) *redis.Cmd
 }
@@ -0,0 +1,335 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//Iterator 分批遍历Find的结果 每次只在内存中保留一批数据
+//只设置了Where时通过SCAN逐页读取 Cursor返回的游标可以通过Query.Cursor从中断的位置继续遍历
+//游标为SCAN的游标与该页中的位置 redis只保证完整遍历期间一直存在的key至少返回一次
+//两页之间写入数据或rehash时同一个SCAN游标得到的页可能不同 从游标继续时数据可能重复或遗漏
+//设置了WhereField Range OrderBy时先从索引中得到有序的key 再分批读取 游标为索引结果中的偏移
+//两页之间写入或删除的数据同样可能使索引查询的结果重复或遗漏
+//Offset只在没有游标时生效 游标已经包含了跳过的数据
+type Iterator struct {
+	query *Query
+	ctx   context.Context
+	typ   reflect.Type
+
+	scan       bool     //是否通过SCAN遍历
+	indexKeys  []string //通过索引得到的还未读取的key
+	indexStart int64    //索引查询开始的偏移
+	indexTotal int      //索引查询得到的key数量
+	more       bool     //索引查询在Limit之后还有数据
+	pageCursor uint64   //当前页SCAN开始的游标
+	nextCursor uint64   //下一页SCAN开始的游标
+	finished   bool     //没有下一页
+
+	keys []string //当前页的key
+	data map[string]map[string]string
+	pos  int
+
+	offset   int64 //SCAN需要跳过的数据条数
+	skipped  int64
+	returned int64
+	current  reflect.Value
+	err      error
+}
+
+//Iterate 遍历model类型的数据 model为结构体指针 仅用于确定数据类型
+func (query *Query) Iterate(ctx context.Context, model interface{}) *Iterator {
+	typ := reflect.TypeOf(model)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	it := &Iterator{query: query, ctx: ctx, typ: typ}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		it.err = RormModelMustBeStruct
+		return it
+	}
+
+	if query.OrderField != "" || query.RangeField != "" || len(query.WhereValues) > 0 {
+		if it.indexStart, it.err = parseIndexCursor(query.CursorValue, query.OffsetValue); it.err != nil {
+			return it
+		}
+		//多读取一条判断是否还有下一页
+		indexQuery := *query
+		indexQuery.OffsetValue = it.indexStart
+		if query.LimitValue > 0 {
+			indexQuery.LimitValue = query.LimitValue + 1
+		}
+		keys, err := indexQuery.findKeys(ctx, typ)
+		if err != nil {
+			it.err = err
+			return it
+		}
+		if query.LimitValue > 0 && int64(len(keys)) > query.LimitValue {
+			keys, it.more = keys[:query.LimitValue], true
+		}
+		it.indexKeys = keys
+		it.indexTotal = len(keys)
+		return it
+	}
+
+	if query.Pattern == "" {
+		it.err = errors.New(`Query Pattern can not be ""`)
+		return it
+	}
+	it.scan = true
+	if it.nextCursor, it.pos, it.err = parseCursor(query.CursorValue); it.err != nil {
+		return it
+	}
+	if query.CursorValue == "" {
+		it.offset = query.OffsetValue
+	}
+	return it
+}
+
+//Next 移动到下一条数据 没有数据 出错或ctx被取消时返回false
+func (it *Iterator) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		//索引查询已经在findKeys中分页
+		if it.scan && it.query.LimitValue > 0 && it.returned >= it.query.LimitValue {
+			return false
+		}
+
+		if it.keys != nil && it.pos < len(it.keys) {
+			key := it.keys[it.pos]
+			data := it.data[key]
+			it.pos++
+			if len(data) == 0 {
+				//数据已过期或被删除
+				continue
+			}
+			if it.scan && it.skipped < it.offset {
+				it.skipped++
+				continue
+			}
+
+			element := reflect.New(it.typ)
+			if it.err = it.query.migrate(it.ctx, key, it.typ, data); it.err != nil {
+				return false
+			}
+			if it.err = it.query.retrieveData(key, data, element.Interface()); it.err != nil {
+				return false
+			}
+			if it.err = callAfterFind(it.ctx, element.Interface()); it.err != nil {
+				return false
+			}
+			it.current = element
+			it.returned++
+			return true
+		}
+
+		if !it.fetch() {
+			return false
+		}
+	}
+}
+
+//fetch 读取下一页数据
+func (it *Iterator) fetch() bool {
+	var keys []string
+	start := 0
+	if it.scan {
+		if it.finished {
+			return false
+		}
+		page, next, err := it.query.client.Scan(it.ctx, it.nextCursor, it.query.scanPattern(), int64(it.query.batchSize())).Result()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		//从游标恢复时 跳过该页中已经遍历过的key
+		if it.keys == nil && it.pos > 0 {
+			start = it.pos
+			if start > len(page) {
+				start = len(page)
+			}
+		}
+		it.pageCursor = it.nextCursor
+		it.nextCursor = next
+		it.finished = next == 0
+		keys = page
+	} else {
+		if len(it.indexKeys) == 0 {
+			return false
+		}
+		size := it.query.batchSize()
+		if size > len(it.indexKeys) {
+			size = len(it.indexKeys)
+		}
+		keys = it.indexKeys[:size]
+		it.indexKeys = it.indexKeys[size:]
+	}
+
+	data, err := it.query.getDataFromRedis(it.ctx, it.typ, keys[start:]...)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.keys = keys
+	it.data = data
+	it.pos = start
+	return true
+}
+
+//Scan 将当前数据复制到v中 v为结构体指针
+func (it *Iterator) Scan(v interface{}) error {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return RormPTRNeed
+	}
+	if !it.current.IsValid() {
+		return RormDataNotFound
+	}
+	if val.Elem().Type() != it.typ {
+		return fmt.Errorf("can not scan %s into %s", it.typ, val.Elem().Type())
+	}
+	val.Elem().Set(it.current.Elem())
+	return nil
+}
+
+//Err 遍历过程中出现的错误
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+//Cursor 得到下一条数据的位置 遍历结束时返回""
+func (it *Iterator) Cursor() string {
+	if it.err != nil {
+		return ""
+	}
+	if !it.scan {
+		remaining := len(it.indexKeys)
+		if it.keys != nil {
+			remaining += len(it.keys) - it.pos
+		}
+		if remaining == 0 && !it.more {
+			return ""
+		}
+		return formatIndexCursor(it.indexStart + int64(it.indexTotal-remaining))
+	}
+	if it.keys == nil {
+		return it.query.CursorValue
+	}
+	if it.pos >= len(it.keys) {
+		if it.finished {
+			return ""
+		}
+		return formatCursor(it.nextCursor, 0)
+	}
+	return formatCursor(it.pageCursor, it.pos)
+}
+
+//Each 遍历所有数据并对每条数据调用fn fn的类型为func(*T) error或func(T) error fn返回错误时停止遍历
+func (query *Query) Each(ctx context.Context, fn interface{}) (err error) {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	errorType := reflect.TypeOf((*error)(nil)).Elem()
+	if fnType.Kind() != reflect.Func || fnType.NumIn() != 1 || fnType.NumOut() != 1 || fnType.Out(0) != errorType {
+		return errors.New("fn must be func(*T) error or func(T) error")
+	}
+
+	argType := fnType.In(0)
+	it := query.Iterate(ctx, reflect.New(argType).Interface())
+	for it.Next() {
+		arg := it.current
+		if argType.Kind() != reflect.Ptr {
+			arg = arg.Elem()
+		}
+		if result := fnValue.Call([]reflect.Value{arg})[0]; !result.IsNil() {
+			return result.Interface().(error)
+		}
+	}
+	return it.Err()
+}
+
+//FindPage 从Cursor设置的位置开始读取最多Limit条数据到v中 返回下一页的游标 没有下一页时返回""
+func (query *Query) FindPage(ctx context.Context, v interface{}) (next string, err error) {
+	if reflect.TypeOf(v).Kind() != reflect.Ptr || reflect.TypeOf(v).Elem().Kind() != reflect.Slice {
+		return "", RormModelMustBeSlice
+	}
+	it, err := query.findSlice(ctx, v)
+	if err != nil {
+		return
+	}
+	return it.Cursor(), nil
+}
+
+//findSlice 遍历所有数据并追加到v中 v为slice指针
+func (query *Query) findSlice(ctx context.Context, v interface{}) (it *Iterator, err error) {
+	elementTyp := reflect.TypeOf(v).Elem().Elem()
+	value := reflect.ValueOf(v).Elem()
+
+	it = query.Iterate(ctx, reflect.New(elementTyp).Interface())
+	for it.Next() {
+		if elementTyp.Kind() == reflect.Ptr {
+			value = reflect.Append(value, it.current)
+		} else {
+			value = reflect.Append(value, it.current.Elem())
+		}
+	}
+	if err = it.Err(); err != nil {
+		return
+	}
+	reflect.ValueOf(v).Elem().Set(value)
+	return
+}
+
+//游标格式为 SCAN游标:该页中已遍历的key数量
+func formatCursor(scanCursor uint64, pos int) string {
+	return fmt.Sprintf("%d:%d", scanCursor, pos)
+}
+
+//索引查询的游标格式为 i:偏移
+func formatIndexCursor(offset int64) string {
+	return fmt.Sprintf("i:%d", offset)
+}
+
+//parseIndexCursor 得到索引查询开始的偏移 没有游标时使用offset
+func parseIndexCursor(cursor string, offset int64) (int64, error) {
+	if cursor == "" {
+		return offset, nil
+	}
+	if !strings.HasPrefix(cursor, "i:") {
+		return 0, RormInvalidCursor
+	}
+	offset, err := strconv.ParseInt(strings.TrimPrefix(cursor, "i:"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, RormInvalidCursor
+	}
+	return offset, nil
+}
+
+func parseCursor(cursor string) (scanCursor uint64, pos int, err error) {
+	if cursor == "" {
+		return
+	}
+	arrs := strings.Split(cursor, ":")
+	if len(arrs) != 2 {
+		err = RormInvalidCursor
+		return
+	}
+	if scanCursor, err = strconv.ParseUint(arrs[0], 10, 64); err != nil {
+		err = RormInvalidCursor
+		return
+	}
+	if pos, err = strconv.Atoi(arrs[1]); err != nil || pos < 0 {
+		err = RormInvalidCursor
+	}
+	return
+}
@@ -0,0 +1,188 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type IterTest struct {
+	ID   string `redis:"primary"`
+	TEST int
+}
+
+func prepareIterTest(t *testing.T, n int) []string {
+	ctx := context.Background()
+	models := []*IterTest{}
+	ids := []string{}
+	for i := 0; i < n; i++ {
+		models = append(models, &IterTest{ID: fmt.Sprintf("iter%02d", i), TEST: i})
+		ids = append(ids, fmt.Sprintf("iter%02d", i))
+	}
+	if _, err := redisClient.NewQuery().CreateMany(ctx, models); err != nil {
+		t.Fatalf("Query.CreateMany() error = %v", err)
+	}
+	return ids
+}
+
+func TestQuery_Each(t *testing.T) {
+	ids := prepareIterTest(t, 25)
+	errStop := errors.New("stop")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		query     *Query
+		ctx       context.Context
+		stopAfter int
+		wantCount int
+		wantErr   error
+	}{
+		{
+			name:      "each with small batch",
+			query:     redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4),
+			ctx:       context.Background(),
+			wantCount: len(ids),
+		},
+		{
+			name:      "each with offset and limit",
+			query:     redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4).Offset(3).Limit(10),
+			ctx:       context.Background(),
+			wantCount: 10,
+		},
+		{
+			name:      "stop when fn return error",
+			query:     redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4),
+			ctx:       context.Background(),
+			stopAfter: 5,
+			wantCount: 5,
+			wantErr:   errStop,
+		},
+		{
+			name:      "stop when context canceled",
+			query:     redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4),
+			ctx:       canceled,
+			wantCount: 0,
+			wantErr:   context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count := 0
+			err := tt.query.Each(tt.ctx, func(v *IterTest) error {
+				if tt.stopAfter > 0 && count >= tt.stopAfter {
+					return errStop
+				}
+				count++
+				return nil
+			})
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantCount, count)
+		})
+	}
+}
+
+type IterIndexTest struct {
+	ID    string `redis:"primary"`
+	Group string `redis:"index"`
+	Score int    `redis:"index:range"`
+}
+
+func TestQuery_FindPageIndex(t *testing.T) {
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		err := redisClient.NewQuery().Create(ctx, &IterIndexTest{ID: fmt.Sprintf("ii%d", i), Group: "g", Score: i})
+		assert.Nil(t, err)
+	}
+
+	queries := map[string]func() *Query{
+		"where field": func() *Query { return redisClient.NewQuery().WhereField("Group", "g") },
+		"order by":    func() *Query { return redisClient.NewQuery().OrderBy("Score", true) },
+	}
+	for name, newQuery := range queries {
+		t.Run(name, func(t *testing.T) {
+			got := []string{}
+			cursor := ""
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatalf("Query.FindPage() did not finish")
+				}
+				result := []IterIndexTest{}
+				next, err := newQuery().Limit(2).Cursor(cursor).FindPage(ctx, &result)
+				assert.Nil(t, err)
+				if pages < 2 {
+					assert.Len(t, result, 2)
+					assert.NotEqual(t, "", next)
+				}
+				for _, data := range result {
+					got = append(got, data.ID)
+				}
+				if next == "" {
+					break
+				}
+				cursor = next
+			}
+			assert.ElementsMatch(t, []string{"ii0", "ii1", "ii2", "ii3", "ii4"}, got)
+		})
+	}
+	_, err := redisClient.NewQuery().WhereField("Group", "g").Cursor("0:1").FindPage(ctx, &[]IterIndexTest{})
+	assert.Equal(t, RormInvalidCursor, err)
+}
+
+func TestQuery_FindPage(t *testing.T) {
+	ids := prepareIterTest(t, 25)
+	ctx := context.Background()
+
+	got := []string{}
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatalf("Query.FindPage() did not finish")
+		}
+		result := []IterTest{}
+		next, err := redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4).Limit(7).Cursor(cursor).FindPage(ctx, &result)
+		if err != nil {
+			t.Fatalf("Query.FindPage() error = %v", err)
+		}
+		assert.LessOrEqual(t, len(result), 7)
+		for _, data := range result {
+			got = append(got, data.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(got)
+	assert.Equal(t, ids, got)
+
+	//Offset只在第一页生效 从游标继续时不再跳过
+	got = got[:0]
+	cursor = ""
+	for pages := 0; ; pages++ {
+		if pages > len(ids) {
+			t.Fatalf("Query.FindPage() did not finish")
+		}
+		result := []IterTest{}
+		next, err := redisClient.NewQuery().Where("*IterTest/ID/iter*").Batch(4).Offset(3).Limit(7).Cursor(cursor).FindPage(ctx, &result)
+		if err != nil {
+			t.Fatalf("Query.FindPage() error = %v", err)
+		}
+		for _, data := range result {
+			got = append(got, data.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, len(ids)-3, len(got))
+
+	_, err := redisClient.NewQuery().Where("*IterTest/ID/iter*").Cursor("bad").FindPage(ctx, &[]IterTest{})
+	assert.Equal(t, RormInvalidCursor, err)
+}
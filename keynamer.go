@@ -0,0 +1,284 @@
+package rorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//KeyNamer 决定数据与索引在redis中的key 通过BFRRedis.SetKeyNamer设置
+//model为ModelName得到的model名称 主键与索引的值需要转义 不能包含分隔符与SCAN的特殊字符
+type KeyNamer interface {
+	//Prefix model所有数据key的共同前缀 用于遍历model的所有数据与Rekey
+	Prefix(model string) string
+	//Key 数据的key 必须以Prefix(model)开头 fields为主键字段存储的名称 values为对应的值
+	Key(model string, fields, values []string) string
+	//IndexPrefix model所有索引key的共同前缀 用于Rekey
+	IndexPrefix(model string) string
+	//IndexKey 索引的key 必须以IndexPrefix(model)开头 name为索引名 范围索引为字段名与range
+	IndexKey(model string, name string, values []string) string
+	//Pattern 将Where设置的模式转换为SCAN使用的模式 例如加上命名空间
+	Pattern(pattern string) string
+}
+
+//KeyNamerOption NewKeyNamer的选项
+type KeyNamerOption func(namer *keyNamer)
+
+//Namespace 所有key以namespace加分隔符开头 用于多个环境或服务共用redis
+//例如 rorm.NewKeyNamer(rorm.Namespace("staging"))
+func Namespace(namespace string) KeyNamerOption {
+	return func(namer *keyNamer) {
+		namer.namespace = namespace
+	}
+}
+
+//Separator key中各部分之间的分隔符 默认为/
+func Separator(separator string) KeyNamerOption {
+	return func(namer *keyNamer) {
+		namer.separator = separator
+	}
+}
+
+//LowerCase model名称 字段名与索引名使用小写 值不变
+func LowerCase() KeyNamerOption {
+	return func(namer *keyNamer) {
+		namer.lower = true
+	}
+}
+
+//NoEscape 主键与索引的值不转义 得到与转义之前的版本相同的key
+//值中含有分隔符或SCAN的特殊字符时key会产生歧义 只用于读写之前版本存储的数据
+func NoEscape() KeyNamerOption {
+	return func(namer *keyNamer) {
+		namer.noEscape = true
+	}
+}
+
+//keyNamer 内置的KeyNamer
+//数据 <namespace>/<model>/<field>/<value> 索引 <namespace>/rorm:index:<model>/<index>/<value>
+//值中的 % / * ? [ ] \ 与分隔符会被转义为%XX 含有这些字符的值与之前版本的key不同
+//之前版本存储的这类数据可以通过RekeyNamer从NoEscape的KeyNamer移动到转义后的key 或者一直使用NoEscape
+type keyNamer struct {
+	namespace string
+	separator string
+	lower     bool
+	noEscape  bool
+}
+
+//defaultKeyNamer 没有设置KeyNamer时使用
+var defaultKeyNamer = NewKeyNamer()
+
+//NewKeyNamer 创建内置的KeyNamer
+func NewKeyNamer(options ...KeyNamerOption) KeyNamer {
+	namer := &keyNamer{separator: "/"}
+	for _, option := range options {
+		option(namer)
+	}
+	return namer
+}
+
+func (namer *keyNamer) name(name string) string {
+	if namer.lower {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+func (namer *keyNamer) escape(value string) string {
+	if namer.noEscape {
+		return value
+	}
+	return escapeKeyValue(value, namer.separator)
+}
+
+func (namer *keyNamer) root() string {
+	if namer.namespace == "" {
+		return ""
+	}
+	return namer.namespace + namer.separator
+}
+
+func (namer *keyNamer) Prefix(model string) string {
+	return namer.root() + namer.name(model) + namer.separator
+}
+
+func (namer *keyNamer) Key(model string, fields, values []string) string {
+	var b strings.Builder
+	b.WriteString(namer.Prefix(model))
+	for i, value := range values {
+		if i > 0 {
+			b.WriteString(namer.separator)
+		}
+		if i < len(fields) {
+			b.WriteString(namer.name(fields[i]))
+			b.WriteString(namer.separator)
+		}
+		b.WriteString(namer.escape(value))
+	}
+	return b.String()
+}
+
+func (namer *keyNamer) IndexPrefix(model string) string {
+	return namer.root() + indexKeyPrefix + namer.name(model) + namer.separator
+}
+
+func (namer *keyNamer) IndexKey(model string, name string, values []string) string {
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, namer.escape(value))
+	}
+	return namer.IndexPrefix(model) + namer.name(name) + namer.separator + strings.Join(escaped, namer.separator)
+}
+
+func (namer *keyNamer) Pattern(pattern string) string {
+	return escapePattern(namer.root()) + pattern
+}
+
+//SetKeyNamer 设置数据与索引key的命名方式 之后创建的Query生效
+//修改命名方式后已存储的数据需要通过RekeyNamer迁移
+func (r *BFRRedis) SetKeyNamer(namer KeyNamer) {
+	r.keyNamer = namer
+}
+
+//RekeyNamer 将使用from写入的model数据与索引移动到当前KeyNamer的key下 返回移动的数据条数
+//用于迁移转义之前写入的数据 例如 query.RekeyNamer(ctx, &User{}, rorm.NewKeyNamer(rorm.NoEscape()))
+//数据逐条读出后按主键重新写入 加密字段使用新的key重新加密 保留过期时间 不调用钩子
+//key不变的数据只移动索引 新key下已经存在的数据不会被覆盖 最后返回ErrDuplicateKey
+//移动期间不能有客户端使用from写入
+func (query *Query) RekeyNamer(ctx context.Context, model interface{}, from KeyNamer) (count int, err error) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() != reflect.Ptr {
+		return 0, RormPTRNeed
+	}
+	old := *query
+	old.keyNamer = from
+	keys, err := query.scanPatternKeys(escapePattern(from.Prefix(getSchema(typ).Name)) + "*")
+	if err != nil {
+		return
+	}
+
+	var conflicts []string
+	for start := 0; start < len(keys); start += query.batchSize() {
+		end := start + query.batchSize()
+		if end > len(keys) {
+			end = len(keys)
+		}
+		data, err := old.getDataFromRedis(ctx, typ, keys[start:end]...)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys[start:end] {
+			moved, err := query.rekeyRecord(ctx, &old, typ, key, data[key])
+			if err == ErrDuplicateKey {
+				conflicts = append(conflicts, key)
+				continue
+			} else if err != nil {
+				return count, err
+			}
+			if moved {
+				count++
+			}
+		}
+	}
+	if len(conflicts) > 0 {
+		err = fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(conflicts, ", "))
+	}
+	return
+}
+
+//rekeyRecord 将old读出的一条数据写入当前KeyNamer得到的key 并移动索引
+func (query *Query) rekeyRecord(ctx context.Context, old *Query, typ reflect.Type, oldKey string, data map[string]string) (moved bool, err error) {
+	if len(data) == 0 {
+		return
+	}
+	v := newModel(typ)
+	if err = old.retrieveData(oldKey, data, v); err != nil {
+		return
+	}
+	newKey, err := query.getPrimaryKey(v)
+	if err != nil {
+		return
+	}
+
+	pipe := query.client.Pipeline()
+	if newKey == oldKey {
+		//范围索引中的成员不变 只移动值需要转义的索引
+		indexes := getModelIndexes(typ)
+		stored, err := query.getStoredIndexData(ctx, oldKey, typ, getIndexFields(indexes))
+		if err != nil {
+			return false, err
+		}
+		for _, index := range indexes {
+			oldIndex, newIndex := index.key(old.namer(), typ, stored), index.key(query.namer(), typ, stored)
+			if oldIndex != newIndex {
+				pipe.SRem(ctx, oldIndex, oldKey)
+				pipe.SAdd(ctx, newIndex, newKey)
+			}
+		}
+		_, err = pipe.Exec(ctx)
+		return false, err
+	}
+
+	exists, err := query.client.Exists(ctx, newKey).Result()
+	if err != nil {
+		return
+	} else if exists > 0 {
+		return false, ErrDuplicateKey
+	}
+	ttl, err := query.client.Do(ctx, "pttl", oldKey).Int64()
+	if err != nil {
+		return
+	}
+	if err = old.pipeDeleteIndexes(ctx, pipe, oldKey, v); err != nil {
+		return
+	}
+	pipe.Del(ctx, oldKey)
+	if _, err = query.pipeCreate(ctx, pipe, v); err != nil {
+		return
+	}
+	if ttl > 0 {
+		pipe.PExpire(ctx, newKey, time.Duration(ttl)*time.Millisecond)
+	}
+	_, err = pipe.Exec(ctx)
+	return err == nil, err
+}
+
+//namer 得到Query使用的KeyNamer
+func (query *Query) namer() KeyNamer {
+	if query.keyNamer == nil {
+		return defaultKeyNamer
+	}
+	return query.keyNamer
+}
+
+//scanPattern 得到Where设置的模式对应的SCAN模式
+func (query *Query) scanPattern() string {
+	return query.namer().Pattern(query.Pattern)
+}
+
+//keyEscapes 需要转义的字符 %用于转义本身 /与分隔符会使主键之间产生歧义 其余为SCAN的特殊字符
+const keyEscapes = "%/*?[]\\"
+
+//EscapeKeyValue 转义默认KeyNamer中的主键值 供rormgen生成的代码使用
+func EscapeKeyValue(value string) string {
+	return escapeKeyValue(value, "/")
+}
+
+//escapeKeyValue 将value中的特殊字符与separator中的字符转义为%XX
+func escapeKeyValue(value string, separator string) string {
+	if !strings.ContainsAny(value, keyEscapes) && !strings.ContainsAny(value, separator) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if strings.IndexByte(keyEscapes, c) >= 0 || strings.IndexByte(separator, c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,154 @@
+package rorm
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type KeyNamerTest struct {
+	ID    string  `redis:"primary"`
+	Shard int     `redis:"primary"`
+	Group string  `redis:"index"`
+	Score float64 `redis:"index:range"`
+}
+
+func TestKeyNamer(t *testing.T) {
+	namer := NewKeyNamer()
+	assert.Equal(t, "pkg/Model/ID/1/Shard/2", namer.Key("pkg/Model", []string{"ID", "Shard"}, []string{"1", "2"}))
+	assert.Equal(t, "pkg/Model/ID/a%2Fb%2A%25", namer.Key("pkg/Model", []string{"ID"}, []string{"a/b*%"}))
+	assert.Equal(t, "rorm:index:pkg/Model/Group/a%5B%5D", namer.IndexKey("pkg/Model", "Group", []string{"a[]"}))
+	assert.Equal(t, "pkg/Model/ID/*", namer.Pattern("pkg/Model/ID/*"))
+
+	namer = NewKeyNamer(Namespace("staging"), Separator(":"), LowerCase())
+	assert.Equal(t, "staging:pkg/model:", namer.Prefix("pkg/Model"))
+	assert.Equal(t, "staging:pkg/model:id:a%3Ab%2F:shard:2", namer.Key("pkg/Model", []string{"ID", "Shard"}, []string{"a:b/", "2"}))
+	assert.Equal(t, "staging:rorm:index:pkg/model:group:A:B", namer.IndexKey("pkg/Model", "Group", []string{"A", "B"}))
+	assert.Equal(t, "staging:x*", namer.Pattern("x*"))
+	assert.Equal(t, `stag\*ing/x*`, NewKeyNamer(Namespace("stag*ing")).Pattern("x*"))
+
+	namer = NewKeyNamer(NoEscape())
+	assert.Equal(t, "pkg/Model/ID/a/b*%", namer.Key("pkg/Model", []string{"ID"}, []string{"a/b*%"}))
+	assert.Equal(t, "rorm:index:pkg/Model/Group/a[]", namer.IndexKey("pkg/Model", "Group", []string{"a[]"}))
+}
+
+func TestBFRRedis_SetKeyNamer(t *testing.T) {
+	ctx := context.Background()
+	staging := NewBFRRedis(NewDefaultOptions(), nil)
+	staging.SetKeyNamer(NewKeyNamer(Namespace("staging")))
+	name := ModelName(&KeyNamerTest{})
+
+	models := []*KeyNamerTest{{ID: "a/b", Shard: 1, Group: "g*", Score: 1}, {ID: "a", Shard: 1, Group: "g*", Score: 2}}
+	for _, model := range models {
+		err := staging.NewQuery().Create(ctx, model)
+		assert.Nil(t, err)
+	}
+	exists, err := redisClient.client.Exists(ctx,
+		"staging/"+name+"/ID/a%2Fb/Shard/1",
+		"staging/rorm:index:"+name+"/Group/g%2A",
+		"staging/rorm:index:"+name+"/Score/range",
+	).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), exists)
+
+	result := &KeyNamerTest{ID: "a/b", Shard: 1}
+	err = staging.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, models[0], result)
+	err = redisClient.NewQuery().Find(ctx, &KeyNamerTest{ID: "a/b", Shard: 1})
+	assert.Equal(t, RormDataNotFound, err)
+
+	var found []*KeyNamerTest
+	err = staging.NewQuery().WhereField("Group", "g*").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, models, found)
+	found = nil
+	err = staging.NewQuery().Range("Score", 1.5, nil).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, models[1:], found)
+
+	//Where的模式在命名空间之内
+	found = nil
+	err = staging.NewQuery().Where(name+"/ID/a/*").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, models[1:], found)
+	count, err := staging.NewQuery().Where(name+"/*").Count(ctx, &KeyNamerTest{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	//设置了KeyNamer时不使用RedisKey
+	model := &HashModelTest{ID: "k1"}
+	err = staging.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, model.calls["RedisKey"])
+	exists, err = redisClient.client.Exists(ctx, "staging/"+ModelName(model)+"/ID/k1").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), exists)
+}
+
+type RekeyNamerTest struct {
+	ID     string  `redis:"primary"`
+	Group  string  `redis:"index"`
+	Score  float64 `redis:"index:range"`
+	Secret string  `redis:"encrypt"`
+}
+
+func TestQuery_RekeyNamer(t *testing.T) {
+	ctx := context.Background()
+	name := ModelName(&RekeyNamerTest{})
+	clearModelKeys(t, name)
+	ring := &KeyRing{Current: "k1", Keys: map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}}
+	noEscape := NewKeyNamer(NoEscape())
+	legacy := NewBFRRedis(NewDefaultOptions(), nil)
+	legacy.SetKeyNamer(noEscape)
+	legacy.SetKeyProvider(ring)
+	client := NewBFRRedis(NewDefaultOptions(), nil)
+	client.SetKeyProvider(ring)
+
+	//转义之前写入的数据 a/b的key需要转义 c的key不变 但索引值g*需要转义
+	models := []*RekeyNamerTest{
+		{ID: "a/b", Group: "g*", Score: 1, Secret: "s1"},
+		{ID: "c", Group: "g*", Score: 2, Secret: "s2"},
+	}
+	for _, model := range models {
+		err := legacy.NewQuery().Create(ctx, model)
+		assert.Nil(t, err)
+	}
+	err := redisClient.client.Do(ctx, "pexpire", name+"/ID/a/b", 60000).Err()
+	assert.Nil(t, err)
+	err = client.NewQuery().Find(ctx, &RekeyNamerTest{ID: "a/b"})
+	assert.Equal(t, RormDataNotFound, err)
+
+	count, err := client.NewQuery().RekeyNamer(ctx, &RekeyNamerTest{}, noEscape)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+
+	for _, model := range models {
+		result := &RekeyNamerTest{ID: model.ID}
+		err = client.NewQuery().Find(ctx, result)
+		assert.Nil(t, err)
+		assert.Equal(t, model, result)
+	}
+	var found []*RekeyNamerTest
+	err = client.NewQuery().WhereField("Group", "g*").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, models, found)
+	found = nil
+	err = client.NewQuery().Range("Score", 0, nil).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, models, found)
+
+	exists, err := redisClient.client.Exists(ctx, name+"/ID/a/b", indexKeyPrefix+name+"/Group/g*").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), exists)
+	ttl, err := redisClient.client.Do(ctx, "pttl", name+"/ID/a%2Fb").Int64()
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0, ttl)
+
+	//再次执行时没有需要移动的数据
+	count, err = client.NewQuery().RekeyNamer(ctx, &RekeyNamerTest{}, noEscape)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,396 @@
+package rorm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+//StorageLayout model在redis中的存储方式
+type StorageLayout uint
+
+const (
+	HashLayout      StorageLayout = iota //每个字段存储为HMAP中的一个字段 默认方式
+	BlobLayout                           //整个结构体序列化后存储为一个字符串 默认使用JSON
+	RedisJSONLayout                      //存储为RedisJSON文档 更新字段时使用路径更新 需要redis加载RedisJSON模块
+)
+
+//LayoutModel 实现LayoutModel的model使用RedisLayout返回的存储方式
+//BlobLayout与RedisJSONLayout中嵌套的结构体直接保存在文档中 SubModel(true)不会再单独存储foreignKey关联的子model
+type LayoutModel interface {
+	RedisLayout() StorageLayout
+}
+
+//DocumentCodec BlobLayout序列化整个结构体的方式
+type DocumentCodec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+//DocumentCodecModel 使用BlobLayout的model实现DocumentCodecModel时 使用返回的DocumentCodec代替JSON 例如MessagePack
+type DocumentCodecModel interface {
+	RedisDocumentCodec() DocumentCodec
+}
+
+type jsonDocumentCodec struct{}
+
+func (jsonDocumentCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonDocumentCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+//documentField 文档存储方式读取数据时 原始文档在数据map中的字段名 不会与结构体字段名冲突
+const documentField = "$"
+
+//newModel 创建typ类型的结构体指针 用于调用model实现的接口
+func newModel(typ reflect.Type) interface{} {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return reflect.New(typ).Interface()
+}
+
+//getLayout 得到typ类型的存储方式
+func getLayout(typ reflect.Type) StorageLayout {
+	if typ == nil {
+		return HashLayout
+	}
+	return getSchema(typ).Layout
+}
+
+//getDocumentCodec 得到typ类型序列化文档的方式 RedisJSONLayout始终使用JSON
+func getDocumentCodec(typ reflect.Type) DocumentCodec {
+	return getSchema(typ).documentCodec
+}
+
+//pipeSetDocument 在pipeline中写入整个文档 写入不会改变已有的过期时间
+func (query *Query) pipeSetDocument(ctx context.Context, pipe redis.Pipeliner, key string, v interface{}) error {
+	args, err := documentSetArgs(key, v)
+	if err != nil {
+		return err
+	}
+	return pipe.Do(ctx, args...).Err()
+}
+
+//documentSetArgs 得到写入整个文档的命令
+func documentSetArgs(key string, v interface{}) ([]interface{}, error) {
+	typ := reflect.TypeOf(v)
+	data, err := getDocumentCodec(typ).Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if getLayout(typ) == RedisJSONLayout {
+		return []interface{}{"JSON.SET", key, ".", string(data)}, nil
+	}
+	return []interface{}{"set", key, string(data), "keepttl"}, nil
+}
+
+//documentGetArgs 得到读取整个文档的命令
+func documentGetArgs(layout StorageLayout, key string) []interface{} {
+	if layout == RedisJSONLayout {
+		return []interface{}{"JSON.GET", key}
+	}
+	return []interface{}{"get", key}
+}
+
+//getDocuments 读取typ类型的文档 与HGetAll的结果一样 不存在的key对应空map
+func (query *Query) getDocuments(ctx context.Context, typ reflect.Type, keys ...string) (map[string]map[string]string, error) {
+	layout := getLayout(typ)
+	pipe := query.client.Pipeline()
+	cmds := make([]*redis.Cmd, 0, len(keys))
+	for _, key := range keys {
+		cmds = append(cmds, pipe.Do(ctx, documentGetArgs(layout, key)...))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	mapData := make(map[string]map[string]string, len(keys))
+	for i, cmd := range cmds {
+		raw, err := cmd.Text()
+		if err == redis.Nil {
+			mapData[keys[i]] = map[string]string{}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		mapData[keys[i]] = map[string]string{documentField: raw}
+	}
+	return mapData, nil
+}
+
+//readDocument 读取key对应的文档并解析为typ类型 文档不存在时返回无效的reflect.Value
+func (query *Query) readDocument(ctx context.Context, key string, typ reflect.Type) (val reflect.Value, err error) {
+	raw, err := query.client.Do(ctx, documentGetArgs(getLayout(typ), key)...).Text()
+	if err == redis.Nil {
+		return val, nil
+	} else if err != nil {
+		return
+	}
+	model := newModel(typ)
+	if err = getDocumentCodec(typ).Unmarshal([]byte(raw), model); err != nil {
+		return
+	}
+	return reflect.ValueOf(model).Elem(), nil
+}
+
+//lookupDocumentField 根据Address.City形式的字段名得到结构体字段及其在RedisJSON中的路径
+//字段在JSON中的名称遵循json标签
+func lookupDocumentField(typ reflect.Type, name string) (path string, sf reflect.StructField, ok bool) {
+	for _, part := range strings.Split(name, ".") {
+		for typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		if typ.Kind() != reflect.Struct {
+			return "", sf, false
+		}
+		if sf, ok = typ.FieldByName(part); !ok {
+			return
+		}
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			return "", sf, false
+		}
+		if jsonName == "" {
+			jsonName = sf.Name
+		}
+		path += "." + jsonName
+		typ = sf.Type
+	}
+	return path, sf, true
+}
+
+//lookupModelField 根据model的存储方式查找字段 HashLayout只能访问inline结构体中的字段
+func lookupModelField(typ reflect.Type, name string) (field modelField, ok bool) {
+	if getLayout(typ) == HashLayout {
+		return lookupField(typ, name)
+	}
+	_, sf, ok := lookupDocumentField(typ, name)
+	if !ok {
+		return field, false
+	}
+	return modelField{sf: newSchemaField(sf), name: name, stored: name}, true
+}
+
+//fieldByName 根据Address.City形式的字段名得到结构体中的值 create为true时创建路径上的nil指针
+func fieldByName(val reflect.Value, name string, create bool) (field reflect.Value, ok bool) {
+	field = val
+	for _, part := range strings.Split(name, ".") {
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				if !create {
+					return field, false
+				}
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.Struct {
+			return field, false
+		}
+		sf, ok := field.Type().FieldByName(part)
+		if !ok {
+			return reflect.Value{}, false
+		}
+		if field = fieldByIndex(field, sf.Index, create); !field.IsValid() {
+			return field, false
+		}
+	}
+	return field, true
+}
+
+//assignValue 将更新的值写入结构体字段 支持指针与可以转换的数值类型
+func assignValue(dst reflect.Value, value reflect.Value) error {
+	switch {
+	case !value.IsValid():
+		dst.Set(reflect.Zero(dst.Type()))
+	case value.Type().AssignableTo(dst.Type()):
+		dst.Set(value)
+	case value.Kind() == reflect.Ptr && value.Type().Elem().AssignableTo(dst.Type()):
+		if value.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+		} else {
+			dst.Set(value.Elem())
+		}
+	case dst.Kind() == reflect.Ptr && value.Type().AssignableTo(dst.Type().Elem()):
+		ptr := reflect.New(dst.Type().Elem())
+		ptr.Elem().Set(value)
+		dst.Set(ptr)
+	case isNumberKind(value.Kind()) && isNumberKind(dst.Kind()), value.Kind() == dst.Kind():
+		if !value.Type().ConvertibleTo(dst.Type()) {
+			return fmt.Errorf("can not assign %s to %s", value.Type(), dst.Type())
+		}
+		dst.Set(value.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("can not assign %s to %s", value.Type(), dst.Type())
+	}
+	return nil
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+//updateValue 更新的字段
+type updateValue struct {
+	modelField
+	value reflect.Value
+}
+
+//updateFields 根据model的存储方式更新字段
+//HashLayout通过HSET更新 RedisJSONLayout通过JSON.SET路径更新 BlobLayout读取整个文档修改后写回
+func (query *Query) updateFields(ctx context.Context, hashKey string, model interface{}, values []updateValue) error {
+	typ := reflect.TypeOf(model)
+	layout := getLayout(typ)
+	if layout == BlobLayout {
+		return query.updateBlob(ctx, hashKey, model, values)
+	}
+	if err := query.migrateStored(ctx, hashKey, typ); err != nil {
+		return err
+	}
+
+	return query.execUpdate(ctx, hashKey, model, func(line redis.Pipeliner) error {
+		indexData := map[string]reflect.Value{}
+		for _, value := range values {
+			indexData[value.name] = value.value
+		}
+		if err := query.pipeUpdateIndexes(ctx, line, hashKey, model, indexData); err != nil {
+			return err
+		}
+
+		for _, value := range values {
+			if layout == HashLayout {
+				err := walkField(value.stored, value.sf, value.value, func(name string, schemaField *SchemaField, field reflect.Value) error {
+					return query.pipeHSet(ctx, line, hashKey, name, schemaField, field)
+				})
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			path, _, _ := lookupDocumentField(typ, value.name)
+			var data interface{}
+			if value.value.IsValid() {
+				data = value.value.Interface()
+			}
+			encoded, err := json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			if err = line.Do(ctx, "JSON.SET", hashKey, path, string(encoded)).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+//updateBlob 在WATCH中读取整个文档 修改字段后写回 期间文档被其他客户端修改时返回ErrStaleVersion
+//model定义了redis:"version"字段时 同时比较并增加文档中的版本
+func (query *Query) updateBlob(ctx context.Context, key string, model interface{}, values []updateValue) (err error) {
+	typ := reflect.TypeOf(model)
+	codec := getDocumentCodec(typ)
+	versionField, hasVersion := getVersionField(typ)
+	var version int64
+
+	err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+		raw, err := tx.Get(ctx, key).Bytes()
+		if err == redis.Nil {
+			return RormPrimaryKeyNotFound
+		} else if err != nil {
+			return err
+		}
+		doc := newModel(typ)
+		if err = codec.Unmarshal(raw, doc); err != nil {
+			return err
+		}
+		docValue := reflect.ValueOf(doc).Elem()
+
+		if hasVersion {
+			stored := fieldByIndex(docValue, versionField.Index, true)
+			if getVersionValue(stored) != getVersionValue(fieldByIndex(reflect.ValueOf(model).Elem(), versionField.Index, true)) {
+				return ErrStaleVersion
+			}
+			version = getVersionValue(stored) + 1
+			setVersionValue(stored, version)
+		}
+
+		indexData := map[string]reflect.Value{}
+		for _, value := range values {
+			field, ok := fieldByName(docValue, value.name, true)
+			if !ok {
+				return RormFieldNotExist
+			}
+			if err = assignValue(field, value.value); err != nil {
+				return err
+			}
+			indexData[value.name] = field
+		}
+		data, err := codec.Marshal(doc)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := query.pipeUpdateIndexes(ctx, pipe, key, model, indexData); err != nil {
+				return err
+			}
+			return pipe.Set(ctx, key, data, redis.KeepTTL).Err()
+		})
+		return err
+	}, key)
+
+	if err == redis.TxFailedErr {
+		return ErrStaleVersion
+	} else if err != nil {
+		return
+	}
+	if hasVersion {
+		setVersionValue(fieldByIndex(reflect.ValueOf(model).Elem(), versionField.Index, true), version)
+	}
+	return
+}
+
+//versionArgs 得到读取与增加版本的命令
+func versionArgs(layout StorageLayout, typ reflect.Type, key string, versionField reflect.StructField) (get []interface{}, incr []interface{}) {
+	if layout == RedisJSONLayout {
+		path, _, _ := lookupDocumentField(typ, versionField.Name)
+		return []interface{}{"JSON.GET", key, path}, []interface{}{"JSON.NUMINCRBY", key, path, 1}
+	}
+	name := getFieldName(versionField)
+	return []interface{}{"hget", key, name}, []interface{}{"hincrby", key, name, 1}
+}
+
+//parseStoredVersion 解析存储的版本 不存在时为0
+func parseStoredVersion(cmd *redis.Cmd) (int64, error) {
+	text, err := cmd.Text()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if text == "null" {
+		return 0, nil
+	}
+	version, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid stored version " + text)
+	}
+	return version, nil
+}
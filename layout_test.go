@@ -0,0 +1,162 @@
+package rorm
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type BlobProfile struct {
+	Nickname string
+	Tags     []string
+}
+
+type BlobTest struct {
+	ID      string `redis:"primary"`
+	Name    string `redis:"index"`
+	Score   int
+	Version int64 `redis:"version"`
+	Profile *BlobProfile
+	Extra   map[string]int
+}
+
+func (BlobTest) RedisLayout() StorageLayout { return BlobLayout }
+
+func TestQuery_BlobLayout(t *testing.T) {
+	ctx := context.Background()
+	model := &BlobTest{
+		ID:      "blob1",
+		Name:    "alice",
+		Score:   10,
+		Profile: &BlobProfile{Nickname: "al", Tags: []string{"a", "b"}},
+		Extra:   map[string]int{"x": 1},
+	}
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	key := GetTypeFullName(model) + "/ID/blob1"
+	typ, err := redisClient.client.Do(ctx, "type", key).Text()
+	assert.Nil(t, err)
+	assert.Equal(t, "string", typ)
+
+	result := &BlobTest{ID: "blob1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, model, result)
+
+	err = redisClient.NewQuery().Mode(InsertOnly).Create(ctx, &BlobTest{ID: "blob1"})
+	assert.Equal(t, ErrDuplicateKey, err)
+
+	//更新嵌套结构体中的字段 版本加1
+	err = redisClient.NewQuery().Update(ctx, result, "Profile.Nickname", "ally")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), result.Version)
+	err = redisClient.NewQuery().Updates(ctx, result, map[string]interface{}{"Name": "bob", "Score": int32(20)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), result.Version)
+	err = redisClient.NewQuery().Update(ctx, &BlobTest{ID: "blob1"}, "Score", 30)
+	assert.Equal(t, ErrStaleVersion, err)
+	err = redisClient.NewQuery().Update(ctx, result, "Missing", 30)
+	assert.Equal(t, RormFieldNotExist, err)
+
+	result = &BlobTest{ID: "blob1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, "ally", result.Profile.Nickname)
+	assert.Equal(t, []string{"a", "b"}, result.Profile.Tags)
+	assert.Equal(t, "bob", result.Name)
+	assert.Equal(t, 20, result.Score)
+
+	//索引随文档更新
+	var found []BlobTest
+	err = redisClient.NewQuery().WhereField("Name", "bob").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Len(t, found, 1)
+	found = nil
+	err = redisClient.NewQuery().WhereField("Name", "alice").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+
+	var nicknames []string
+	err = redisClient.NewQuery().Where(GetTypeFullName(model)+"/ID/blob*").Model(&BlobTest{}).Pluck(ctx, "Profile.Nickname", &nicknames)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ally"}, nicknames)
+
+	err = redisClient.NewQuery().Delete(ctx, &BlobTest{ID: "blob1"})
+	assert.Nil(t, err)
+	found = nil
+	err = redisClient.NewQuery().WhereField("Name", "bob").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+}
+
+type gobDocumentCodec struct{}
+
+func (gobDocumentCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobDocumentCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type GobTest struct {
+	ID      string `redis:"primary"`
+	Created time.Time
+	Values  []float64
+}
+
+func (GobTest) RedisLayout() StorageLayout        { return BlobLayout }
+func (GobTest) RedisDocumentCodec() DocumentCodec { return gobDocumentCodec{} }
+
+func TestQuery_BlobDocumentCodec(t *testing.T) {
+	ctx := context.Background()
+	model := &GobTest{ID: "gob1", Created: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), Values: []float64{1.5, 2}}
+	err := redisClient.NewQuery().Expire(60).Create(ctx, model)
+	assert.Nil(t, err)
+
+	var results []*GobTest
+	err = redisClient.NewQuery().Where(GetTypeFullName(model)+"/ID/gob*").Find(ctx, &results)
+	assert.Nil(t, err)
+	if assert.Len(t, results, 1) {
+		assert.True(t, model.Created.Equal(results[0].Created))
+		assert.Equal(t, model.Values, results[0].Values)
+	}
+}
+
+type RedisJSONTest struct {
+	ID      string `redis:"primary" json:"id"`
+	Version int    `redis:"version" json:"version"`
+	Profile struct {
+		Nickname string `json:"nick"`
+	} `json:"profile"`
+	Hidden string `json:"-"`
+}
+
+func (RedisJSONTest) RedisLayout() StorageLayout { return RedisJSONLayout }
+
+func TestRedisJSONLayoutCommands(t *testing.T) {
+	model := &RedisJSONTest{ID: "json1"}
+	args, err := documentSetArgs("key", model)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"JSON.SET", "key", ".", `{"id":"json1","version":0,"profile":{"nick":""}}`}, args)
+	assert.Equal(t, []interface{}{"JSON.GET", "key"}, documentGetArgs(RedisJSONLayout, "key"))
+
+	path, _, ok := lookupDocumentField(reflect.TypeOf(model), "Profile.Nickname")
+	assert.True(t, ok)
+	assert.Equal(t, ".profile.nick", path)
+	_, _, ok = lookupDocumentField(reflect.TypeOf(model), "Hidden")
+	assert.False(t, ok)
+
+	versionField, _ := getVersionField(reflect.TypeOf(model))
+	get, incr := versionArgs(RedisJSONLayout, reflect.TypeOf(model), "key", versionField)
+	assert.Equal(t, []interface{}{"JSON.GET", "key", ".version"}, get)
+	assert.Equal(t, []interface{}{"JSON.NUMINCRBY", "key", ".version", 1}, incr)
+}
@@ -1,8 +1,6 @@
 package rorm
 
 import (
-	"encoding/json"
-	"fmt"
 	"math/rand"
 	"reflect"
 	"time"
@@ -37,55 +35,30 @@ func RandStringBytesMaskImprSrcUnsafe(n int) string {
 }
 
 func GetTypeFullName(myvar interface{}) string {
-	if t := reflect.TypeOf(myvar); t.Kind() == reflect.Ptr {
+	return getTypeFullNameOfType(reflect.TypeOf(myvar))
+}
+
+func getTypeFullNameOfType(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
 		return t.Elem().PkgPath() + "/" + t.Elem().Name()
 	} else {
 		return t.PkgPath() + "/" + t.Name()
 	}
 }
 
+//ConvertStructToMap 将结构体转换为存储在redis中的map 各字段使用其类型对应的Codec
 func ConvertStructToMap(v interface{}) map[string]string {
 	data := make(map[string]string)
 
-	val := reflect.ValueOf(v).Elem()
-	typ := reflect.TypeOf(v)
-
-	num := val.NumField()
-
-	for i := 0; i < num; i++ {
-		key := typ.Elem().Field(i).Name
-		field := val.FieldByName(key)
-		Value := field.Interface()
-		switch field.Kind() {
-		case reflect.Ptr:
-			switch field.Elem().Kind() {
-			case reflect.Struct:
-			case reflect.Ptr:
-			case reflect.Bool:
-				if field.Interface().(bool) {
-					data[key] = "1"
-				} else {
-					data[key] = "0"
-				}
-			case reflect.Array, reflect.Slice, reflect.Map:
-				json, _ := json.Marshal(Value)
-				data[key] = string(json)
-			default:
-				data[key] = fmt.Sprintf("%v", field.Elem().Interface())
-			}
-		case reflect.Struct: //对于结构体 将直接作为一个单独的HMAP存储
-		case reflect.Slice, reflect.Array, reflect.Map: //对于Slice Array Map三种类型 直接存储其对应的JSON
-			json, _ := json.Marshal(Value)
-			data[key] = string(json)
-		case reflect.Bool:
-			if field.Interface().(bool) {
-				data[key] = "1"
-			} else {
-				data[key] = "0"
-			}
-		default:
-			data[key] = fmt.Sprintf("%v", field.Interface())
+	//对于结构体 将直接作为一个单独的HMAP存储 inline结构体展开为多个字段
+	walkFields("", reflect.ValueOf(v).Elem(), func(key string, schemaField *SchemaField, field reflect.Value) error {
+		if schemaField.omitted(field) {
+			return nil
 		}
-	}
+		if value, err := schemaField.encode(field); err == nil {
+			data[key] = value
+		}
+		return nil
+	})
 	return data
 }
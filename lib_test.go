@@ -44,6 +44,8 @@ func TestConvertStructToMap(t *testing.T) {
 			},
 		},
 	}
+	//TIMETEST实现了Valuer接口 与Create时一样存储其RedisValue
+	mapData["TIMETEST"] = data.TIMETEST.RedisValue()
 
 	type args struct {
 		v interface{}
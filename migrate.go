@@ -0,0 +1,287 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//schemaVersionField HMAP中存储schema版本的隐藏字段 结构体字段名中不会出现$
+const schemaVersionField = "$v"
+
+var ErrMigrationNotFound = errors.New("migration not found for schema version")
+
+//Migration 将版本为version-1的数据转换为version版本
+//data为HMAP中存储的原始字符串 使用存储的字段名 加密与压缩的字段仍为存储的格式
+//直接修改data 删除的字段从data中delete 重命名的字段需要删除旧的字段名
+type Migration func(ctx context.Context, data map[string]string) error
+
+var (
+	migrationsMu sync.Mutex
+	migrations   sync.Map //reflect.Type => map[int]Migration 注册时复制后整体替换
+)
+
+//RegisterMigration 注册model类型从version-1升级到version的迁移函数 version从1开始
+//model的schema版本为注册的最大version HASH布局写入数据时同时写入版本 没有版本的数据为0
+//Find与Iterate读取到旧版本的数据时依次执行迁移函数后再解析 BlobLayout与RedisJSONLayout不支持
+func RegisterMigration(model interface{}, version int, migration Migration) {
+	if version < 1 {
+		panic("migration version must start from 1")
+	}
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	registered := map[int]Migration{}
+	if old, ok := migrations.Load(typ); ok {
+		for v, m := range old.(map[int]Migration) {
+			registered[v] = m
+		}
+	}
+	registered[version] = migration
+	migrations.Store(typ, registered)
+	resetSchemas()
+}
+
+//getMigrations 得到typ注册的迁移函数与当前的schema版本
+func getMigrations(typ reflect.Type) (registered map[int]Migration, version int) {
+	value, ok := migrations.Load(typ)
+	if !ok {
+		return nil, 0
+	}
+	registered = value.(map[int]Migration)
+	for v := range registered {
+		if v > version {
+			version = v
+		}
+	}
+	return
+}
+
+//WriteMigrated Find与Iterate迁移旧版本的数据后是否写回redis
+func (query *Query) WriteMigrated(flag bool) *Query {
+	query.MigrateWriteBack = flag
+	return query
+}
+
+//pipeSchemaVersion 在pipeline中写入数据的schema版本
+func pipeSchemaVersion(ctx context.Context, pipe redis.Pipeliner, key string, typ reflect.Type) error {
+	schema := getSchema(typ)
+	if schema.SchemaVersion == 0 || schema.Layout != HashLayout {
+		return nil
+	}
+	return pipe.HSet(ctx, key, schemaVersionField, schema.SchemaVersion).Err()
+}
+
+//migrate 将读取到的旧版本数据迁移到当前版本 迁移后的data中不包含版本字段
+//data必须是HMAP中的所有字段 版本比当前版本新的数据不做转换
+func (query *Query) migrate(ctx context.Context, key string, typ reflect.Type, data map[string]string) error {
+	_, err := query.migrateData(ctx, key, typ, data, query.MigrateWriteBack)
+	return err
+}
+
+//migrateData 迁移data writeBack为true时将迁移后的数据写回redis 返回是否写回
+func (query *Query) migrateData(ctx context.Context, key string, typ reflect.Type, data map[string]string, writeBack bool) (written bool, err error) {
+	schema := getSchema(typ)
+	stored, ok := data[schemaVersionField]
+	if len(data) == 0 || schema.Layout != HashLayout || (!ok && schema.SchemaVersion == 0) {
+		return
+	}
+	version := 0
+	if ok {
+		if version, err = strconv.Atoi(stored); err != nil {
+			return false, fmt.Errorf("invalid schema version %q of %s", stored, key)
+		}
+	}
+	if version >= schema.SchemaVersion {
+		delete(data, schemaVersionField)
+		return
+	}
+
+	old := make(map[string]string, len(data))
+	for name, value := range data {
+		old[name] = value
+	}
+	delete(data, schemaVersionField)
+	for v := version + 1; v <= schema.SchemaVersion; v++ {
+		migration, ok := schema.migrations[v]
+		if !ok {
+			return false, fmt.Errorf("%w: %s version %d", ErrMigrationNotFound, schema.Name, v)
+		}
+		if err = migration(ctx, data); err != nil {
+			return false, fmt.Errorf("migrate %s to version %d: %w", key, v, err)
+		}
+	}
+	if writeBack {
+		return query.writeMigrated(ctx, key, schema, old, data)
+	}
+	return
+}
+
+//migrateStored 部分更新字段前将redis中旧版本的数据迁移并写回
+//否则更新写入的新格式的值在之后读取时会被再次迁移
+func (query *Query) migrateStored(ctx context.Context, key string, typ reflect.Type) error {
+	schema := getSchema(typ)
+	if schema.SchemaVersion == 0 || schema.Layout != HashLayout {
+		return nil
+	}
+	for retry := 0; retry < 3; retry++ {
+		data, err := query.client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if version, _ := strconv.Atoi(data[schemaVersionField]); len(data) == 0 || version >= schema.SchemaVersion {
+			return nil
+		}
+		written, err := query.migrateData(ctx, key, typ, data, true)
+		if err != nil || written {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+//writeMigrated 在WATCH中写回迁移后的数据 并更新变化的索引
+//读取后数据被其他客户端修改时放弃写回 下次读取时重新迁移 写回不改变redis:"version"字段
+func (query *Query) writeMigrated(ctx context.Context, key string, schema *ModelSchema, old, data map[string]string) (written bool, err error) {
+	err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.HGetAll(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(current, old) {
+			return nil
+		}
+
+		var deleted []string
+		for name := range old {
+			if _, ok := data[name]; !ok && name != schemaVersionField {
+				deleted = append(deleted, name)
+			}
+		}
+		changed := map[string]interface{}{schemaVersionField: strconv.Itoa(schema.SchemaVersion)}
+		for name, value := range data {
+			if stored, ok := old[name]; !ok || stored != value {
+				changed[name] = value
+			}
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if len(deleted) > 0 {
+				pipe.HDel(ctx, key, deleted...)
+			}
+			pipe.HSet(ctx, key, changed)
+			return query.pipeMigratedIndexes(ctx, pipe, key, schema, old, data)
+		})
+		written = err == nil
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return
+}
+
+//pipeMigratedIndexes 在pipeline中更新迁移前后值不同的索引
+//只能处理当前schema中定义的索引 旧版本中已删除或重命名的索引字段需要在迁移后重建索引
+func (query *Query) pipeMigratedIndexes(ctx context.Context, pipe redis.Pipeliner, key string, schema *ModelSchema, old, data map[string]string) error {
+	oldIndex, newIndex := map[string]string{}, map[string]string{}
+	for _, name := range getIndexFields(schema.Indexes) {
+		field := schema.byName[name]
+		//旧版本的值可能无法按当前类型解析 此时使用存储的原值
+		if value, ok := old[field.Stored]; ok {
+			if converted, ok := storedIndexValue(field, value); ok {
+				value = converted
+			}
+			oldIndex[name] = value
+		}
+		if value, ok := data[field.Stored]; ok {
+			if converted, ok := storedIndexValue(field, value); ok {
+				value = converted
+			}
+			newIndex[name] = value
+		}
+	}
+	for _, index := range schema.Indexes {
+		oldKey, newKey := index.key(query.namer(), schema.Type, oldIndex), index.key(query.namer(), schema.Type, newIndex)
+		if oldKey == newKey {
+			continue
+		}
+		if oldKey != "" {
+			pipe.SRem(ctx, oldKey, key)
+		}
+		if newKey != "" {
+			pipe.SAdd(ctx, newKey, key)
+		}
+	}
+
+	for _, name := range schema.RangeFields {
+		field := schema.byName[name]
+		value, ok := data[field.Stored]
+		if stored, exists := old[field.Stored]; exists == ok && stored == value {
+			continue
+		}
+		if !ok {
+			pipe.ZRem(ctx, query.rangeIndexKey(schema.Type, name), key)
+			continue
+		}
+		decoded := reflect.New(field.Type).Elem()
+		if err := query.decodeField(key, field.Stored, value, field, decoded); err != nil {
+			return err
+		}
+		score, err := rangeScore(decoded)
+		if err != nil {
+			pipe.ZRem(ctx, query.rangeIndexKey(schema.Type, name), key)
+			continue
+		}
+		pipe.ZAdd(ctx, query.rangeIndexKey(schema.Type, name), &redis.Z{Score: score, Member: key})
+	}
+	return nil
+}
+
+//Migrate 将model类型的所有数据迁移到当前的schema版本并写回 返回写回的数据条数
+//默认遍历类型全名/*的所有key 可以通过Where WhereField等条件限制范围
+func (query *Query) Migrate(ctx context.Context, model interface{}) (count int, err error) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() != reflect.Ptr {
+		return 0, RormPTRNeed
+	}
+	schema := getSchema(typ)
+	if schema.Layout != HashLayout {
+		return 0, errors.New("migrate only support hash layout")
+	}
+	if schema.SchemaVersion == 0 {
+		return 0, nil
+	}
+	keys, err := query.modelKeys(ctx, typ)
+	if err != nil {
+		return
+	}
+	for start := 0; start < len(keys); start += query.batchSize() {
+		end := start + query.batchSize()
+		if end > len(keys) {
+			end = len(keys)
+		}
+		data, err := query.getDataFromRedis(ctx, typ, keys[start:end]...)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys[start:end] {
+			written, err := query.migrateData(ctx, key, typ, data[key], true)
+			if err != nil {
+				return count, err
+			}
+			if written {
+				count++
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,186 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MigrateTest struct {
+	ID    string `redis:"primary"`
+	Name  string `redis:"index"`
+	Count int
+	Score float64 `redis:"index:range"`
+}
+
+type MigrateMissingTest struct {
+	ID string `redis:"primary"`
+}
+
+func init() {
+	//版本1 字段nm重命名为Name
+	RegisterMigration(&MigrateTest{}, 1, func(ctx context.Context, data map[string]string) error {
+		if name, ok := data["nm"]; ok {
+			data["Name"] = name
+			delete(data, "nm")
+		}
+		return nil
+	})
+	//版本2 Count由小数改为整数 Score由百分比改为小数
+	RegisterMigration(&MigrateTest{}, 2, func(ctx context.Context, data map[string]string) error {
+		if count, ok := data["Count"]; ok {
+			f, err := strconv.ParseFloat(count, 64)
+			if err != nil {
+				return err
+			}
+			data["Count"] = strconv.Itoa(int(math.Round(f)))
+		}
+		if score, ok := data["Score"]; ok {
+			f, err := strconv.ParseFloat(score, 64)
+			if err != nil {
+				return err
+			}
+			data["Score"] = strconv.FormatFloat(f/100, 'f', -1, 64)
+		}
+		return nil
+	})
+	RegisterMigration(&MigrateMissingTest{}, 2, func(ctx context.Context, data map[string]string) error {
+		return nil
+	})
+}
+
+//writeOldMigrateTest 写入版本0的数据
+func writeOldMigrateTest(t *testing.T, ctx context.Context, id string) string {
+	key := GetTypeFullName(&MigrateTest{}) + "/ID/" + id
+	err := redisClient.client.Do(ctx, "hset", key, "ID", id, "nm", "bob", "Count", "1.6", "Score", "50").Err()
+	assert.Nil(t, err)
+	return key
+}
+
+func TestQuery_Migrate(t *testing.T) {
+	ctx := context.Background()
+	clearModelKeys(t, GetTypeFullName(&MigrateTest{}), GetTypeFullName(&MigrateMissingTest{}))
+	assert.Equal(t, 2, GetModelSchema(&MigrateTest{}).SchemaVersion)
+	want := &MigrateTest{ID: "m1", Name: "bob", Count: 2, Score: 0.5}
+
+	//读取时迁移 默认不写回
+	key := writeOldMigrateTest(t, ctx, "m1")
+	result := &MigrateTest{ID: "m1"}
+	err := redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, want, result)
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", stored["nm"])
+
+	//Select时读取所有字段迁移后再选择
+	result = &MigrateTest{ID: "m1"}
+	err = redisClient.NewQuery().Select("Name").Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, &MigrateTest{ID: "m1", Name: "bob"}, result)
+
+	//Pluck同样读取迁移后的值
+	var counts []int
+	err = redisClient.NewQuery().Where(GetTypeFullName(&MigrateTest{})+"/ID/m1").Model(&MigrateTest{}).Pluck(ctx, "Count", &counts)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2}, counts)
+
+	//写回迁移后的数据与索引
+	result = &MigrateTest{ID: "m1"}
+	err = redisClient.NewQuery().WriteMigrated(true).Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, want, result)
+	stored, err = redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ID": "m1", "Name": "bob", "Count": "2", "Score": "0.5", schemaVersionField: "2"}, stored)
+	var found []MigrateTest
+	err = redisClient.NewQuery().WhereField("Name", "bob").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, []MigrateTest{*want}, found)
+	found = nil
+	err = redisClient.NewQuery().Range("Score", 0.4, 0.6).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, []MigrateTest{*want}, found)
+
+	//已经是当前版本的数据不再迁移
+	result = &MigrateTest{ID: "m1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, want, result)
+
+	//新写入的数据带有当前版本
+	err = redisClient.NewQuery().Create(ctx, &MigrateTest{ID: "m2", Name: "amy", Count: 3, Score: 0.1})
+	assert.Nil(t, err)
+	version, err := redisClient.client.HGet(ctx, GetTypeFullName(&MigrateTest{})+"/ID/m2", schemaVersionField).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", version)
+
+	//缺少中间版本的迁移函数
+	key = GetTypeFullName(&MigrateMissingTest{}) + "/ID/x"
+	err = redisClient.client.Do(ctx, "hset", key, "ID", "x").Err()
+	assert.Nil(t, err)
+	err = redisClient.NewQuery().Find(ctx, &MigrateMissingTest{ID: "x"})
+	assert.True(t, errors.Is(err, ErrMigrationNotFound), err)
+}
+
+func TestQuery_MigrateUpdate(t *testing.T) {
+	ctx := context.Background()
+	clearModelKeys(t, GetTypeFullName(&MigrateTest{}))
+	//更新部分字段前先迁移 更新的值不会被再次迁移
+	key := writeOldMigrateTest(t, ctx, "u1")
+	err := redisClient.NewQuery().Update(ctx, &MigrateTest{ID: "u1"}, "Count", 5)
+	assert.Nil(t, err)
+	result := &MigrateTest{ID: "u1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, &MigrateTest{ID: "u1", Name: "bob", Count: 5, Score: 0.5}, result)
+	version, err := redisClient.client.HGet(ctx, key, schemaVersionField).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "2", version)
+
+	writeOldMigrateTest(t, ctx, "u2")
+	err = redisClient.NewQuery().Updates(ctx, &MigrateTest{ID: "u2"}, map[string]interface{}{"Score": 0.9})
+	assert.Nil(t, err)
+	result = &MigrateTest{ID: "u2"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, &MigrateTest{ID: "u2", Name: "bob", Count: 2, Score: 0.9}, result)
+}
+
+func TestQuery_MigrateAll(t *testing.T) {
+	ctx := context.Background()
+	clearModelKeys(t, GetTypeFullName(&MigrateTest{}))
+	ids := []string{"all1", "all2", "all3"}
+	for _, id := range ids {
+		writeOldMigrateTest(t, ctx, id)
+	}
+
+	//遍历时同样迁移
+	var found []MigrateTest
+	err := redisClient.NewQuery().Where(GetTypeFullName(&MigrateTest{})+"/ID/all*").Find(ctx, &found)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, model := range found {
+		names = append(names, model.ID+":"+model.Name)
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{"all1:bob", "all2:bob", "all3:bob"}, names)
+
+	count, err := redisClient.NewQuery().Where(GetTypeFullName(&MigrateTest{})+"/ID/all*").Migrate(ctx, &MigrateTest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	for _, id := range ids {
+		version, err := redisClient.client.HGet(ctx, GetTypeFullName(&MigrateTest{})+"/ID/"+id, schemaVersionField).Result()
+		assert.Nil(t, err)
+		assert.Equal(t, "2", version)
+	}
+
+	count, err = redisClient.NewQuery().Migrate(ctx, &MigrateTest{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
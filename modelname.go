@@ -0,0 +1,207 @@
+package rorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+//NamedModel 实现NamedModel的model使用RedisName返回的名称作为key与索引的前缀
+//默认的前缀为类型全名 即PkgPath()/Name() 移动model所在的包或修改module路径后已存储的数据无法读取
+type NamedModel interface {
+	RedisName() string
+}
+
+var modelNames sync.Map
+
+//RegisterModelName 注册model类型的名称 优先于RedisName方法
+//例如 rorm.RegisterModelName(&User{}, "user")
+func RegisterModelName(model interface{}, name string) {
+	if name == "" {
+		panic("model name can not be empty")
+	}
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	modelNames.Store(typ, name)
+	resetSchemas()
+}
+
+//ModelName 得到model的名称 即key与索引的前缀
+func ModelName(model interface{}) string {
+	return GetModelSchema(model).Name
+}
+
+//getModelName 依次使用RegisterModelName注册的名称 RedisName方法返回的名称 类型全名
+func getModelName(typ reflect.Type, model interface{}) string {
+	if name, ok := modelNames.Load(typ); ok {
+		return name.(string)
+	}
+	if named, ok := model.(NamedModel); ok {
+		if name := named.RedisName(); name != "" {
+			return name
+		}
+	}
+	return getTypeFullNameOfType(typ)
+}
+
+//Rekey 将名称为oldName时写入的model数据与索引移动到当前名称下 返回移动的数据条数
+//通过RENAMENX移动 保留过期时间 新名称下已经存在的数据不会被覆盖 最后返回ErrDuplicateKey
+//移动期间不能有客户端使用旧名称写入 集群模式下新旧key需要在同一个slot中
+func (query *Query) Rekey(ctx context.Context, model interface{}, oldName string) (count int, err error) {
+	typ := reflect.TypeOf(model)
+	if typ.Kind() != reflect.Ptr {
+		return 0, RormPTRNeed
+	}
+	schema := getSchema(typ)
+	if oldName == "" || oldName == schema.Name {
+		return 0, nil
+	}
+
+	oldPrefix, newPrefix := query.namer().Prefix(oldName), query.namer().Prefix(schema.Name)
+	keys, err := query.scanPatternKeys(escapePattern(oldPrefix) + "*")
+	if err != nil {
+		return
+	}
+	var conflicts []string
+	for start := 0; start < len(keys); start += query.batchSize() {
+		end := start + query.batchSize()
+		if end > len(keys) {
+			end = len(keys)
+		}
+		pipe := query.client.Pipeline()
+		cmds := make([]*redis.Cmd, 0, end-start)
+		for _, key := range keys[start:end] {
+			cmds = append(cmds, pipe.Do(ctx, "renamenx", key, newPrefix+strings.TrimPrefix(key, oldPrefix)))
+		}
+		if _, err = pipe.Exec(ctx); err != nil {
+			return
+		}
+		for i, cmd := range cmds {
+			if renamed, _ := cmd.Int(); renamed == 1 {
+				count++
+			} else {
+				conflicts = append(conflicts, keys[start+i])
+			}
+		}
+	}
+
+	if err = query.rekeyIndexes(ctx, schema, oldName, conflicts); err != nil {
+		return
+	}
+	if len(conflicts) > 0 {
+		err = fmt.Errorf("%w: %s", ErrDuplicateKey, strings.Join(conflicts, ", "))
+	}
+	return
+}
+
+//luaMaxCounter 将旧计数器合并到新计数器中 取两者中较大的值后删除旧计数器
+//KEYS[1] 旧计数器 KEYS[2] 新计数器
+var luaMaxCounter = redis.NewScript(`
+local old = tonumber(redis.call("get", KEYS[1]) or "0")
+local new = tonumber(redis.call("get", KEYS[2]) or "0")
+if old > new then
+	redis.call("set", KEYS[2], old)
+end
+redis.call("del", KEYS[1])
+return 1`)
+
+//rekeyIndexes 将oldName的索引合并到当前名称的索引中 索引中的key同样替换为新的前缀
+//索引的类型由TYPE决定 conflicts中没有移动的数据仍然留在旧的索引中
+func (query *Query) rekeyIndexes(ctx context.Context, schema *ModelSchema, oldName string, conflicts []string) error {
+	namer := query.namer()
+	oldKeyPrefix, newKeyPrefix := namer.Prefix(oldName), namer.Prefix(schema.Name)
+	skipped := map[string]bool{}
+	for _, key := range conflicts {
+		skipped[key] = true
+	}
+	rekey := func(key string) string {
+		if strings.HasPrefix(key, oldKeyPrefix) {
+			return newKeyPrefix + strings.TrimPrefix(key, oldKeyPrefix)
+		}
+		return key
+	}
+
+	oldPrefix, newPrefix := namer.IndexPrefix(oldName), namer.IndexPrefix(schema.Name)
+	keys, err := query.scanPatternKeys(escapePattern(oldPrefix) + "*")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		newKey := newPrefix + strings.TrimPrefix(key, oldPrefix)
+		typ, err := query.client.Do(ctx, "type", key).Text()
+		if err != nil {
+			return err
+		}
+		pipe := query.client.Pipeline()
+		var moved []interface{}
+		kept := 0
+		switch typ {
+		case "string":
+			//auto:incr的计数器取新旧两者中较大的值
+			if err = luaMaxCounter.Run(ctx, query.client, []string{key, newKey}).Err(); err != nil {
+				return err
+			}
+			continue
+		case "zset":
+			read := query.client.Pipeline()
+			cmd := read.ZRangeWithScores(ctx, key, 0, -1)
+			if _, err := read.Exec(ctx); err != nil {
+				return err
+			}
+			for _, member := range cmd.Val() {
+				if skipped[member.Member.(string)] {
+					kept++
+					continue
+				}
+				pipe.ZAdd(ctx, newKey, &redis.Z{Score: member.Score, Member: rekey(member.Member.(string))})
+				moved = append(moved, member.Member)
+			}
+		case "set":
+			members, err := query.client.SMembers(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			for _, member := range members {
+				if skipped[member] {
+					kept++
+					continue
+				}
+				pipe.SAdd(ctx, newKey, rekey(member))
+				moved = append(moved, member)
+			}
+		default:
+			continue
+		}
+		//只删除已经移动的成员 冲突的数据保留原来的索引
+		if kept == 0 {
+			pipe.Del(ctx, key)
+		} else if len(moved) > 0 && typ == "zset" {
+			pipe.ZRem(ctx, key, moved...)
+		} else if len(moved) > 0 {
+			pipe.SRem(ctx, key, moved...)
+		}
+		if _, err = pipe.Exec(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//escapePattern 转义SCAN MATCH中的特殊字符
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+type NamedTest struct {
+	ID    string `redis:"primary"`
+	Group string `redis:"index"`
+}
+
+func (m *NamedTest) RedisName() string {
+	return "named"
+}
+
+type RegisteredNameTest struct {
+	NamedTest
+}
+
+type RekeyTest struct {
+	ID    string  `redis:"primary"`
+	Group string  `redis:"index"`
+	Score float64 `redis:"index:range"`
+}
+
+func init() {
+	RegisterModelName(&RegisteredNameTest{}, "registered")
+}
+
+//registerTestModelName 注册model的名称 测试结束后恢复为默认名称
+func registerTestModelName(t *testing.T, model interface{}, name string) {
+	RegisterModelName(model, name)
+	t.Cleanup(func() {
+		modelNames.Delete(reflect.TypeOf(model).Elem())
+		resetSchemas()
+	})
+}
+
+func TestModelName(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, "named", ModelName(&NamedTest{}))
+	assert.Equal(t, "registered", ModelName(RegisteredNameTest{}))
+	assert.Equal(t, GetTypeFullName(&RekeyTest{}), ModelName(&RekeyTest{}))
+
+	err := redisClient.NewQuery().Create(ctx, &NamedTest{ID: "n1", Group: "a"})
+	assert.Nil(t, err)
+	exists, err := redisClient.client.Exists(ctx, "named/ID/n1", indexKeyPrefix+"named/Group/a").Result()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), exists)
+
+	var found []NamedTest
+	err = redisClient.NewQuery().WhereField("Group", "a").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, []NamedTest{{ID: "n1", Group: "a"}}, found)
+}
+
+func TestQuery_Rekey(t *testing.T) {
+	ctx := context.Background()
+	oldName := ModelName(&RekeyTest{})
+	clearModelKeys(t, oldName, "rekey")
+	models := []*RekeyTest{{ID: "r1", Group: "a", Score: 1}, {ID: "r2", Group: "a", Score: 2}}
+	for _, model := range models {
+		err := redisClient.NewQuery().Create(ctx, model)
+		assert.Nil(t, err)
+	}
+
+	registerTestModelName(t, &RekeyTest{}, "rekey")
+	//改名后旧数据无法读取
+	err := redisClient.NewQuery().Find(ctx, &RekeyTest{ID: "r1"})
+	assert.Equal(t, RormDataNotFound, err)
+
+	count, err := redisClient.NewQuery().Rekey(ctx, &RekeyTest{}, oldName)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	result := &RekeyTest{ID: "r1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, models[0], result)
+	var found []*RekeyTest
+	err = redisClient.NewQuery().WhereField("Group", "a").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, models, found)
+	found = nil
+	err = redisClient.NewQuery().Range("Score", 1.5, nil).Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Equal(t, models[1:], found)
+	keys, err := redisClient.NewQuery().scanPatternKeys("*" + escapePattern(oldName) + "*")
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	//新名称下已经存在的数据不会被覆盖 没有移动的数据保留旧的索引
+	oldIndex := indexKeyPrefix + oldName + "/Group/b"
+	err = redisClient.client.Do(ctx, "hset", oldName+"/ID/r1", "ID", "r1", "Group", "b").Err()
+	assert.Nil(t, err)
+	err = redisClient.client.Do(ctx, "sadd", oldIndex, oldName+"/ID/r1").Err()
+	assert.Nil(t, err)
+	//已经删除的范围索引字段仍然按ZSET移动
+	err = redisClient.client.Do(ctx, "zadd", indexKeyPrefix+oldName+"/Removed/range", 1, oldName+"/ID/r3").Err()
+	assert.Nil(t, err)
+	count, err = redisClient.NewQuery().Rekey(ctx, &RekeyTest{}, oldName)
+	assert.True(t, errors.Is(err, ErrDuplicateKey), err)
+	assert.Equal(t, 0, count)
+	result = &RekeyTest{ID: "r1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", result.Group)
+	members, err := redisClient.client.SMembers(ctx, oldIndex).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{oldName + "/ID/r1"}, members)
+	found = nil
+	err = redisClient.NewQuery().WhereField("Group", "b").Find(ctx, &found)
+	assert.Nil(t, err)
+	assert.Empty(t, found)
+	members, err = redisClient.client.ZRangeByScore(ctx, indexKeyPrefix+"rekey/Removed/range", &redis.ZRangeBy{Min: "-inf", Max: "+inf"}).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rekey/ID/r3"}, members)
+}
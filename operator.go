@@ -2,11 +2,9 @@ package rorm
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
-	"strconv"
 	"strings"
 	"time"
 
@@ -14,23 +12,46 @@ import (
 	"go.uber.org/zap"
 )
 
+const defaultBatchSize = 500
+
 type Query struct {
 	// where       string
 	// value       interface{}
-	Pattern       string //支持正则查询Key
+	Pattern       string                 //支持正则查询Key
+	WhereValues   map[string]interface{} //通过索引查询 字段名=>值
+	RangeField    string                 //通过范围索引查询的字段
+	RangeMin      interface{}
+	RangeMax      interface{}
+	OrderField    string //通过范围索引排序的字段
+	OrderDesc     bool
+	LimitValue    int64
+	OffsetValue   int64
+	CursorValue   string    //FindPage Iterate开始的位置
+	BatchSize     int       //每批处理的数据条数 用于CreateMany与SCAN
+	CreateMode    WriteMode //Create写入数据的方式
+	ModelType     reflect.Type
 	Association   bool
 	SelectValues  []string
 	ExpireTime    time.Duration
 	logger        *zap.Logger
 	client        Redisclient
+	keyProvider   KeyProvider
+	keyNamer      KeyNamer
 	AutomaticLoad bool
+	//MigrateWriteBack Find读取到旧版本的数据迁移后写回redis
+	MigrateWriteBack bool
+	//PlaintextFallback 加密字段没有加密前缀时按明文读取
+	PlaintextFallback bool
 }
 
 func (r *BFRRedis) NewQuery() *Query {
 	return &Query{
 		client:       r.client,
 		logger:       r.logger,
+		keyProvider:  r.keyProvider,
+		keyNamer:     r.keyNamer,
 		SelectValues: []string{},
+		WhereValues:  map[string]interface{}{},
 	}
 }
 
@@ -39,6 +60,56 @@ func (query *Query) Where(pattern string) *Query {
 	return query
 }
 
+//WhereField 通过redis:"index"标签定义的索引查询字段等于v的数据 多次调用时条件取交集
+func (query *Query) WhereField(fieldName string, v interface{}) *Query {
+	if query.WhereValues == nil {
+		query.WhereValues = map[string]interface{}{}
+	}
+	query.WhereValues[fieldName] = v
+	return query
+}
+
+//Range 通过redis:"index:range"标签定义的范围索引查询字段值在[min,max]之间的数据 min或max为nil时表示不限制
+func (query *Query) Range(fieldName string, min, max interface{}) *Query {
+	query.RangeField = fieldName
+	query.RangeMin = min
+	query.RangeMax = max
+	return query
+}
+
+//OrderBy 通过范围索引对Find的结果排序
+func (query *Query) OrderBy(fieldName string, desc bool) *Query {
+	query.OrderField = fieldName
+	query.OrderDesc = desc
+	return query
+}
+
+func (query *Query) Limit(n int64) *Query {
+	query.LimitValue = n
+	return query
+}
+
+func (query *Query) Offset(n int64) *Query {
+	query.OffsetValue = n
+	return query
+}
+
+//Cursor 设置FindPage Iterate开始的位置 cursor为上一页返回的游标 设置了游标时Offset不再生效
+func (query *Query) Cursor(cursor string) *Query {
+	query.CursorValue = cursor
+	return query
+}
+
+//Model 指定Pluck查询的数据类型 model为结构体或结构体指针
+func (query *Query) Model(model interface{}) *Query {
+	typ := reflect.TypeOf(model)
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	query.ModelType = typ
+	return query
+}
+
 func (query *Query) SubModel(flag bool) *Query {
 	query.Association = flag
 	return query
@@ -54,58 +125,79 @@ func (query *Query) Expire(d int64) *Query {
 	return query
 }
 
+//Batch 设置每批处理的数据条数 CreateMany每个pipeline写入的数据条数 Each每次SCAN的COUNT
+func (query *Query) Batch(n int) *Query {
+	query.BatchSize = n
+	return query
+}
+
 func (query *Query) AutoLoad(flag bool) *Query {
 	query.AutomaticLoad = flag
 	return query
 }
 
-func (query *Query) pipeHSet(ctx context.Context, pipe redis.Pipeliner, key string, fieldName string, field reflect.Value) (err error) {
-	switch field.Kind() {
-	case reflect.Ptr:
-		switch field.Elem().Kind() {
-		case reflect.Struct:
-			//如果字段支持直接序列化则直接序列为字符串
-			query.saveStruct(ctx, pipe, key, fieldName, field)
-			if query.Association {
-				if err = query.Create(ctx, (&field).Interface()); err != nil {
-					return err
-				}
-			}
-		case reflect.Ptr:
-			query.logger.Warn("data use Ptr of Ptr.Give Up Save", zap.String("field", fieldName))
-		case reflect.Array, reflect.Slice, reflect.Map:
-			json, _ := json.Marshal(field.Interface())
-			cmd := pipe.HSet(ctx, key, fieldName, string(json))
-			if err = cmd.Err(); err != nil {
-				return err
-			}
-		default:
-			cmd := pipe.HSet(ctx, key, fieldName, field.Elem().Interface())
-			if err = cmd.Err(); err != nil {
-				return err
-			}
-		}
-	case reflect.Struct: //对于结构体 将直接作为一个单独的HMAP存储
-		//先查看是否为
-		query.saveStruct(ctx, pipe, key, fieldName, field)
-		if query.Association {
-			structValue2 := field.Interface()
-			if err := query.Create(ctx, structValue2); err != nil {
-				return err
-			}
-		}
-	case reflect.Slice, reflect.Array, reflect.Map: //对于Slice Array Map三种类型 直接存储其对应的JSON
-		json, _ := json.Marshal(field.Interface())
-		cmd := pipe.HSet(ctx, key, fieldName, string(json))
+func (query *Query) pipeHSet(ctx context.Context, pipe redis.Pipeliner, key string, fieldName string, schemaField *SchemaField, field reflect.Value) (err error) {
+	//omitempty的字段为零值时删除已存储的值
+	if schemaField.omitted(field) {
+		return pipe.HDel(ctx, key, fieldName).Err()
+	}
+	value, ok, err := query.encodeField(key, fieldName, schemaField, field)
+	if err != nil {
+		return err
+	}
+	if ok {
+		cmd := pipe.HSet(ctx, key, fieldName, value)
 		if err = cmd.Err(); err != nil {
 			return err
 		}
-	default:
-		cmd := pipe.HSet(ctx, key, fieldName, field.Interface())
-		if err = cmd.Err(); err != nil {
+	} else if schemaField.isNil(field) {
+		//nil以HMAP中没有该字段表示
+		if err = pipe.HDel(ctx, key, fieldName).Err(); err != nil {
 			return err
 		}
 	}
+	//对于结构体 将直接作为一个单独的HMAP存储
+	if query.Association && isStructValue(field) {
+		if err = query.pipeCreateAssociation(ctx, pipe, field); err != nil {
+			return err
+		}
+	}
+	return
+}
+
+//encodeField 得到字段存储在hashKey的HMAP中的值 ok为false时该字段不需要存储
+func (query *Query) encodeField(hashKey string, fieldName string, schemaField *SchemaField, field reflect.Value) (value interface{}, ok bool, err error) {
+	data, err := schemaField.encode(field)
+	if err == errSkipField {
+		return nil, false, nil
+	}
+	if err == nil && schemaField.encrypted {
+		data, err = query.seal(data, encryptAAD(hashKey, fieldName))
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("encode field %s: %w", fieldName, err)
+	}
+	return data, true, nil
+}
+
+func isStructValue(field reflect.Value) bool {
+	if field.Kind() == reflect.Ptr {
+		return field.Elem().Kind() == reflect.Struct
+	}
+	return field.Kind() == reflect.Struct
+}
+
+//pipeCreateAssociation 在同一个pipeline中写入关联的子model 没有主键的结构体不是子model 直接跳过
+func (query *Query) pipeCreateAssociation(ctx context.Context, pipe redis.Pipeliner, field reflect.Value) (err error) {
+	if field.Kind() != reflect.Ptr {
+		ptr := reflect.New(field.Type())
+		ptr.Elem().Set(field)
+		field = ptr
+	}
+	if _, err = query.getRedisPrimaryField(field.Interface()); err != nil {
+		return nil
+	}
+	_, err = query.pipeCreate(ctx, pipe, field.Interface())
 	return
 }
 
@@ -127,54 +219,72 @@ func (r *Query) getPrimaryKey(v interface{}) (fullKey string, err error) {
 		err = RormModelMustBeStruct
 		return
 	}
-	val := reflect.ValueOf(v).Elem()
-
-	num := val.NumField()
-
-	//遍历结构体的所有字段
-	for i := 0; i < num; i++ {
-		//获取到struct标签，需要通过reflect.Type来获取tag标签的值
-		tagVal := typ.Elem().Field(i).Tag.Get("redis")
-		//如果该字段有tag标签就显示，否则就不显示
-		if tagVal != "" && strings.Contains(tagVal, "primary") {
-			fullKey = fullKey + "/" + typ.Elem().Field(i).Name + "/" + fmt.Sprintf("%v", val.Field(i).Interface())
-		}
+	schema := getSchema(typ)
+	if schema.err != nil {
+		err = schema.err
+		return
 	}
-	if fullKey == "" {
+	//rormgen生成的RedisKey 与默认KeyNamer的格式相同
+	if model, ok := v.(KeyModel); ok && r.keyNamer == nil {
+		return model.RedisKey(), nil
+	}
+	val := reflect.ValueOf(v).Elem()
+	if len(schema.Primaries) == 0 {
 		err = RormPrimaryKeyNotFound
 		return
 	}
-	fullKey = fmt.Sprintf("%s%v", GetTypeFullName(v), fullKey)
+
+	//所有主键字段 包括匿名结构体中提升的字段
+	fields := make([]string, 0, len(schema.Primaries))
+	values := make([]string, 0, len(schema.Primaries))
+	for _, primary := range schema.Primaries {
+		field := fieldByIndex(val, primary.Index, false)
+		if !field.IsValid() {
+			return "", RormPrimaryKeyNotFound
+		}
+		fields = append(fields, primary.Stored)
+		values = append(values, fmt.Sprintf("%v", field.Interface()))
+	}
+	fullKey = r.namer().Key(schema.Name, fields, values)
 	return
 }
 
 func (r *Query) getPrimaryKeyWithNoTags(v interface{}, keySuffix string) string {
-	fullKey := fmt.Sprintf("%s/%v", GetTypeFullName(v), keySuffix)
+	fullKey := fmt.Sprintf("%s%v", r.namer().Prefix(ModelName(v)), keySuffix)
 	return fullKey
 }
 
 func (r *Query) scanPatternKeys(pattern string) ([]string, error) {
 	var cursor uint64
-	var n int
 	var keys []string
-	var err error
 	for {
-		keys, cursor, err = r.client.Scan(context.Background(), cursor, pattern, 10).Result()
+		page, next, err := r.client.Scan(context.Background(), cursor, pattern, int64(r.batchSize())).Result()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		n += len(keys)
+		keys = append(keys, page...)
+		cursor = next
 		if cursor == 0 {
 			break
 		}
 	}
-	return keys, err
+	return keys, nil
+}
+
+//batchSize 每批处理的数据条数 用于SCAN的COUNT与批量读写
+func (query *Query) batchSize() int {
+	if query.BatchSize > 0 {
+		return query.BatchSize
+	}
+	return defaultBatchSize
 }
 
-func (query *Query) getDataFromRedis(keys ...string) (map[string]map[string]string, error) {
+func (query *Query) getDataFromRedis(ctx context.Context, typ reflect.Type, keys ...string) (map[string]map[string]string, error) {
+	if getLayout(typ) != HashLayout {
+		return query.getDocuments(ctx, typ, keys...)
+	}
 	mapData := make(map[string]map[string]string)
 	pipe := query.client.Pipeline()
-	ctx := context.Background()
 
 	var result []*redis.StringStringMapCmd
 
@@ -208,7 +318,7 @@ func (query *Query) getDataFromRedis(keys ...string) (map[string]map[string]stri
 	return mapData, nil
 }
 
-func (query *Query) fetchData(ctx context.Context, v interface{}) (data map[string]string, err error) {
+func (query *Query) fetchData(ctx context.Context, v interface{}) (key string, data map[string]string, err error) {
 	if v == nil {
 		err = RormPTRNeed
 		return
@@ -224,21 +334,34 @@ func (query *Query) fetchData(ctx context.Context, v interface{}) (data map[stri
 		return
 	}
 
-	key, err := query.getPrimaryKey(v)
+	key, err = query.getPrimaryKey(v)
 	if err != nil {
 		return
 	}
-	if len(query.SelectValues) == 0 {
+	if getLayout(reflect.TypeOf(v)) != HashLayout {
+		var documents map[string]map[string]string
+		if documents, err = query.getDocuments(ctx, reflect.TypeOf(v), key); err == nil {
+			data = documents[key]
+		}
+	} else if len(query.SelectValues) == 0 || getSchema(reflect.TypeOf(v)).SchemaVersion > 0 {
+		//注册了迁移函数时读取所有字段 迁移后再选择字段
 		data, err = query.client.HGetAll(ctx, key).Result()
 	} else {
+		//Select可以使用Go中的字段名或存储的字段名
+		fields := make([]string, 0, len(query.SelectValues))
 		for _, field := range query.SelectValues {
-			subdata, err := query.client.HGet(ctx, key, field).Result()
-			if err != nil {
-				return nil, err
+			fields = append(fields, storedFieldName(reflect.TypeOf(v), field))
+		}
+		var values []interface{}
+		if values, err = query.client.HMGet(ctx, key, fields...).Result(); err != nil {
+			return key, nil, err
+		}
+		data = map[string]string{}
+		for i, value := range values {
+			if str, ok := value.(string); ok {
+				data[fields[i]] = str
 			}
-			data[field] = subdata
 		}
-
 	}
 
 	if len(data) == 0 {
@@ -251,153 +374,99 @@ func (query *Query) fetchData(ctx context.Context, v interface{}) (data map[stri
 				if err = loader.Loader(v); err != nil {
 					return
 				}
+				//v已经由Loader填充 返回的data为nil 不需要再解析
 				go query.Create(ctx, v)
-				data = ConvertStructToMap(v)
-				return data, nil
+				return key, nil, nil
 			}
 		}
 		return
 	}
+	if err = query.migrate(ctx, key, reflect.TypeOf(v), data); err != nil {
+		return
+	}
+	if schema := getSchema(reflect.TypeOf(v)); len(query.SelectValues) > 0 && schema.SchemaVersion > 0 && schema.Layout == HashLayout {
+		selected := make(map[string]string, len(query.SelectValues))
+		for _, field := range query.SelectValues {
+			name := storedFieldName(reflect.TypeOf(v), field)
+			if value, ok := data[name]; ok {
+				selected[name] = value
+			}
+		}
+		data = selected
+	}
 	return
 }
 
-func (query *Query) retrieveData(data map[string]string, v interface{}) (err error) {
-
-	val := reflect.ValueOf(v).Elem()
-	typ := reflect.TypeOf(v)
-
-	num := val.NumField()
-
-	for i := 0; i < num; i++ {
-		key := typ.Elem().Field(i).Name
-		value, ok := data[key]
+//retrieveData 将hashKey中读取到的data解析到v中
+func (query *Query) retrieveData(hashKey string, data map[string]string, v interface{}) (err error) {
 
-		if !ok {
-			continue
-		}
-
-		field := val.FieldByName(key)
-
-		if !field.IsValid() {
-			err = errors.New("field is not valid")
-			return
-		}
-		if !field.CanSet() {
-			err = errors.New("field can not be set")
-			return
-		}
+	//文档存储方式直接解析整个文档
+	if document, ok := data[documentField]; ok {
+		return getDocumentCodec(reflect.TypeOf(v)).Unmarshal([]byte(document), v)
+	}
 
-		switch field.Kind() {
-		case reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.Func, reflect.Invalid, reflect.UnsafePointer:
-			query.logger.Warn("this type can not be reflect", zap.String("fieldName", key))
-		case reflect.Int, reflect.Int8, reflect.Int32, reflect.Int64:
-			innerValue, err := strconv.Atoi(value)
-			if err != nil {
-				return err
-			}
-			field.SetInt(int64(innerValue))
-		case reflect.Float32, reflect.Float64:
-			innerValue, err := strconv.ParseFloat(value, 64)
-			if err != nil {
-				return err
-			}
-			field.SetFloat(innerValue)
-		case reflect.String:
-			field.SetString(value)
-		case reflect.Bool:
-			if value == "1" {
-				field.SetBool(true)
-			} else {
-				field.SetBool(false)
-			}
-		case reflect.Uint, reflect.Uint8, reflect.Uint32, reflect.Uint64:
-			innerValue, err := strconv.ParseUint(value, 10, 64)
-			if err != nil {
-				return err
-			}
-			field.SetUint(innerValue)
-
-		case reflect.Slice, reflect.Array:
-			elemType := field.Type()
-			slice := reflect.MakeSlice(elemType, 1, 1)
-			// Create a pointer to a slice value and set it to the slice
-			slicePointer := reflect.New(slice.Type()).Interface()
-			err = json.Unmarshal([]byte(value), slicePointer)
-			if err != nil {
-				return err
-			}
-			if field.Kind() == reflect.Ptr {
-				field.Set(reflect.ValueOf(slicePointer))
-			} else {
-				field.Set(reflect.ValueOf(slicePointer).Elem())
-			}
-		case reflect.Map:
-			elemType := field.Type()
-			mapData := reflect.MakeMap(elemType)
-			mapPointer := reflect.New(mapData.Type()).Interface()
-			err = json.Unmarshal([]byte(value), mapPointer)
-			if err != nil {
-				return err
-			}
-			if field.Kind() == reflect.Ptr {
-				field.Set(reflect.ValueOf(mapPointer))
-			} else {
-				field.Set(reflect.ValueOf(mapPointer).Elem())
-			}
-		case reflect.Struct:
-			//pass struct.
-			//deal it in function loadForeignModel
-			//判断该字段是否直接支持RormData接口，如果支持则直接使用接口反序列化
-			data := field.Addr().Interface()
-			if dataInterce, ok := data.(Scanner); ok {
-				dataInterce.RedisScan([]byte(value))
-				data := reflect.ValueOf(dataInterce).Interface()
-			
-				field.Set(reflect.ValueOf(data).Elem())
-			}
-		
-		case reflect.Ptr:
-			typ := reflect.TypeOf(field.Interface())
-			ptr := reflect.New(typ.Elem()).Interface()
-			err = query.PtrData(value, ptr)
-			if err != nil {
-				return err
-			}
-			// fmt.Println(ptr.String())
-			field.Set(reflect.ValueOf(ptr))
-		default:
-			fmt.Println("not get the type. key is  " + key)
-			fmt.Println("field type kind is:" + field.Kind().String())
-			fmt.Println("field elem  is:" + field.Elem().String())
-			fmt.Println("field elem type kind is:" + field.Elem().Kind().String())
+	//rormgen生成的FromRedisHash Select时只解析选择的字段 仍然使用反射
+	if loader, ok := v.(HashLoader); ok && !query.Association && len(query.SelectValues) == 0 {
+		return loader.FromRedisHash(data)
+	}
 
-		}
+	//inline结构体从展开的字段中还原
+	if err = query.decodeFields(hashKey, "", data, reflect.ValueOf(v).Elem()); err != nil {
+		return
 	}
 
 	//加载关联struct
 	if query.Association {
-		if err = query.loadForeignModel(v, data); err != nil {
+		if err = query.loadForeignModel(hashKey, v, data); err != nil {
 			return err
 		}
 	}
 	return
 }
 
-func (query *Query) loadForeignModel(v interface{}, data map[string]string) (err error) {
+//decodeField 将hashKey中key字段存储的字符串value解析到field中 field必须可以被设置
+func (query *Query) decodeField(hashKey string, key string, value string, schemaField *SchemaField, field reflect.Value) (err error) {
+	if value, err = query.openField(hashKey, key, value, schemaField); err != nil {
+		return
+	}
+	return decodePlainField(key, value, schemaField, field)
+}
+
+//openField 解密加密字段存储的值 其余字段原样返回
+func (query *Query) openField(hashKey string, key string, value string, schemaField *SchemaField) (string, error) {
+	if !schemaField.encrypted {
+		return value, nil
+	}
+	value, err := query.open(value, encryptAAD(hashKey, key))
+	if err != nil {
+		return "", fmt.Errorf("decode field %s: %w", key, err)
+	}
+	return value, nil
+}
+
+//decodePlainField 将没有加密的value解析到field中 默认值直接使用
+func decodePlainField(key string, value string, schemaField *SchemaField, field reflect.Value) (err error) {
+	if err = schemaField.decode(value, field); err == errSkipField {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("decode field %s: %w", key, err)
+	}
+	return
+}
+
+func (query *Query) loadForeignModel(hashKey string, v interface{}, data map[string]string) (err error) {
 	val := reflect.ValueOf(v).Elem()
 	typ := reflect.TypeOf(v)
 
-	num := val.NumField()
-
-	for i := 0; i < num; i++ {
+	for _, fieldType := range getSchema(typ).Fields {
 
-		fieldType := typ.Elem().Field(i)
 		key := fieldType.Name
-		field := val.FieldByName(key)
+		field := fieldByIndex(val, fieldType.Index, false)
 
+		//nil的匿名指针中没有关联的子model
 		if !field.IsValid() {
-			err = errors.New("field is not valid")
-			return
+			continue
 		}
 		if !field.CanSet() {
 			err = errors.New("field can not be set")
@@ -419,17 +488,8 @@ func (query *Query) loadForeignModel(v interface{}, data map[string]string) (err
 			continue
 		}
 
-		var foreignFieldName string
 		if foreignTags != "" && strings.Contains(foreignTags, "foreignKey") {
-			arrs := strings.Split(foreignTags, ";")
-			for _, arr := range arrs {
-				if strings.Contains(arr, "foreignKey") {
-					foreignKeys := strings.Split(arr, ":")
-					if len(foreignKeys) > 1 {
-						foreignFieldName = foreignKeys[1]
-					}
-				}
-			}
+			foreignFieldName := getForeignKeyName(foreignTags)
 
 			if foreignFieldName != "" {
 				structType := fieldType.Type
@@ -443,11 +503,14 @@ func (query *Query) loadForeignModel(v interface{}, data map[string]string) (err
 					query.logger.Error("找到主键对应的field出错")
 					continue
 				}
-				valueOfStruct := structPtr.FieldByName(primaryField.Name)
-				foreignKeyValue := val.FieldByName(foreignFieldName)
-				valueOfStruct.Set(foreignKeyValue)
+				valueOfStruct := fieldByIndex(structPtr, primaryField.Index, true)
+				foreignField, ok := typ.Elem().FieldByName(foreignFieldName)
+				if !ok {
+					return RormFieldNotExist
+				}
+				valueOfStruct.Set(fieldByIndex(val, foreignField.Index, true))
 				ptrToStruct := structPtr.Addr().Interface()
-				err = query.retrieveData(data, ptrToStruct)
+				err = query.retrieveData(hashKey, data, ptrToStruct)
 				if err != nil {
 					return err
 				}
@@ -463,11 +526,8 @@ func (query *Query) loadForeignModel(v interface{}, data map[string]string) (err
 
 func (r *Query) getRedisPrimaryField(v interface{}) (field reflect.StructField, err error) {
 	typ := reflect.TypeOf(v)
-	val := reflect.ValueOf(v)
-
 	if typ.Kind() == reflect.Ptr {
 		typ = typ.Elem()
-		val = val.Elem()
 	}
 
 	if typ.Kind() != reflect.Struct {
@@ -475,58 +535,104 @@ func (r *Query) getRedisPrimaryField(v interface{}) (field reflect.StructField,
 		return
 	}
 
-	num := val.NumField()
-
-	//遍历结构体的所有字段
-	for i := 0; i < num; i++ {
-		fmt.Printf("Field %d:值=%v\n", i, val.Field(i))
-		//获取到struct标签，需要通过reflect.Type来获取tag标签的值
-		tagVal := typ.Field(i).Tag.Get("redis")
-		//如果该字段有tag标签就显示，否则就不显示
-		if tagVal != "" && strings.Contains(tagVal, "primary") {
-			return typ.Field(i), nil
-		}
+	//包括匿名结构体中提升的字段
+	if primaries := getSchema(typ).Primaries; len(primaries) > 0 {
+		return primaries[0].StructField, nil
 	}
 	err = errors.New("not found field with tag redis primary")
 	return
 }
 
+//PtrData 将data解析到v指向的值中 v必须为指针
 func (r *Query) PtrData(data string, v interface{}) (err error) {
-
-	if reflect.ValueOf(v).Kind() != reflect.Ptr {
+	if reflect.ValueOf(v).Kind() != reflect.Ptr || reflect.ValueOf(v).IsNil() {
 		err = errors.New("not a ptr")
 		return
 	}
+	if err = decodeValue(data, reflect.ValueOf(v).Elem()); err == errSkipField {
+		r.logger.Warn("this type can not be reflect", zap.String("fieldName", reflect.TypeOf(v).Elem().Name()), zap.String("value", data))
+		return nil
+	}
+	return
+}
 
-	switch reflect.TypeOf(v).Elem().Kind() {
-	case reflect.Array, reflect.Slice, reflect.Map:
-		err = json.Unmarshal([]byte(data), v)
-		if err != nil {
-			return err
-		}
-	case reflect.Struct:
-		if dataInterce, ok := v.(Scanner); ok {
-			realData := dataInterce.RedisScan(data)
-			reflect.ValueOf(v).Elem().Set(reflect.ValueOf(realData))
+//getForeignKeyName 从redis标签中解析foreignKey:FieldName
+func getForeignKeyName(tag string) (foreignFieldName string) {
+	arrs := strings.Split(tag, ";")
+	for _, arr := range arrs {
+		if strings.Contains(arr, "foreignKey") {
+			foreignKeys := strings.Split(arr, ":")
+			if len(foreignKeys) > 1 {
+				foreignFieldName = foreignKeys[1]
+			}
 		}
-	case reflect.Chan, reflect.Complex64, reflect.Complex128, reflect.Func, reflect.Invalid, reflect.UnsafePointer:
-		r.logger.Warn("this type can not be reflect", zap.String("fieldName", reflect.TypeOf(v).Name()), zap.String("value", data))
-	case reflect.Ptr:
-		r.logger.Warn("pointer of pointer,that's not allowed", zap.String("fieldName", reflect.TypeOf(v).Name()))
-	default:
-		reflect.ValueOf(v).Elem().Set(reflect.ValueOf(data))
 	}
 	return
 }
 
-func (r *Query) saveStruct(ctx context.Context, pipe redis.Pipeliner, key, fieldName string, value reflect.Value) (err error) {
-	valueInterface := value.Interface()
-	if data, ok := valueInterface.(Valuer); ok {
-		dataString := data.RedisValue()
-		cmd := pipe.HSet(ctx, key, fieldName, dataString)
-		if err = cmd.Err(); err != nil {
-			return err
+//getAssociationModels 递归得到model通过foreignKey关联的所有子model 子model中只设置了主键
+//model中foreignKey对应字段为空时 从redis中读取已存储的值
+func (query *Query) getAssociationModels(ctx context.Context, key string, v interface{}) (models []interface{}, err error) {
+	val := reflect.ValueOf(v).Elem()
+	typ := val.Type()
+	//文档存储方式中结构体保存在文档内 没有子model
+	if getLayout(typ) != HashLayout {
+		return
+	}
+
+	for _, fieldType := range getSchema(typ).Fields {
+		structType := fieldType.Type
+		if structType.Kind() == reflect.Ptr {
+			structType = structType.Elem()
+		}
+		if structType.Kind() != reflect.Struct {
+			continue
 		}
+
+		foreignFieldName := fieldType.ForeignKey
+		if foreignFieldName == "" {
+			continue
+		}
+
+		foreignField, ok := typ.FieldByName(foreignFieldName)
+		if !ok {
+			err = RormFieldNotExist
+			return
+		}
+		foreignKeyValue := fieldByIndex(val, foreignField.Index, true)
+
+		structPtr := reflect.New(structType)
+		primaryField, err := query.getRedisPrimaryField(structPtr.Interface())
+		if err != nil {
+			return nil, err
+		}
+		primaryValue := fieldByIndex(structPtr.Elem(), primaryField.Index, true)
+
+		if !foreignKeyValue.IsZero() && foreignKeyValue.Type().AssignableTo(primaryValue.Type()) {
+			primaryValue.Set(foreignKeyValue)
+		} else {
+			stored, err := query.client.HGet(ctx, key, getFieldName(foreignField)).Result()
+			if err == redis.Nil {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			subQuery := &Query{client: query.client, logger: query.logger, keyProvider: query.keyProvider, keyNamer: query.keyNamer}
+			if err = subQuery.retrieveData(key, map[string]string{getFieldName(primaryField): stored}, structPtr.Interface()); err != nil {
+				return nil, err
+			}
+		}
+
+		subKey, err := query.getPrimaryKey(structPtr.Interface())
+		if err != nil {
+			return nil, err
+		}
+		subModels, err := query.getAssociationModels(ctx, subKey, structPtr.Interface())
+		if err != nil {
+			return nil, err
+		}
+		models = append(models, structPtr.Interface())
+		models = append(models, subModels...)
 	}
-	return nil
+	return
 }
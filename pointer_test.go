@@ -0,0 +1,110 @@
+package rorm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type PointerTest struct {
+	ID       string `redis:"primary"`
+	String   *string
+	Int      *int
+	Uint     *uint8
+	Float    *float64
+	Bool     *bool
+	Time     *time.Time
+	Unix     *time.Time `redis:"time:unix"`
+	Duration *time.Duration
+	Slice    *[]string
+	Map      *map[string]int
+	Any      interface{}
+}
+
+type PointerInlineTest struct {
+	ID      string         `redis:"primary"`
+	Billing *InlineAddress `redis:"inline"`
+}
+
+func TestQuery_PointerInline(t *testing.T) {
+	ctx := context.Background()
+	model := &PointerInlineTest{ID: "pi1", Billing: &InlineAddress{City: "X", Zip: 1}}
+	key := GetTypeFullName(model) + "/ID/pi1"
+	err := redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+
+	//更新为nil时删除展开后的所有字段
+	err = redisClient.NewQuery().Update(ctx, &PointerInlineTest{ID: "pi1"}, "Billing", nil)
+	assert.Nil(t, err)
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ID": "pi1"}, stored)
+	result := &PointerInlineTest{ID: "pi1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Nil(t, result.Billing)
+
+	//Create覆盖已有数据时同样删除
+	for _, mode := range []WriteMode{Upsert, UpdateOnly} {
+		err = redisClient.NewQuery().Create(ctx, model)
+		assert.Nil(t, err)
+		err = redisClient.NewQuery().Mode(mode).Create(ctx, &PointerInlineTest{ID: "pi1"})
+		assert.Nil(t, err)
+		result = &PointerInlineTest{ID: "pi1", Billing: &InlineAddress{}}
+		err = redisClient.NewQuery().Find(ctx, result)
+		assert.Nil(t, err)
+		assert.Nil(t, result.Billing)
+	}
+}
+
+func TestQuery_PointerRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	str, i, u, f, b := "", 0, uint8(0), 0.0, false
+	tm, d, s, m := time.Time{}, time.Duration(0), []string{}, map[string]int{}
+	zero := &PointerTest{ID: "p1", String: &str, Int: &i, Uint: &u, Float: &f, Bool: &b,
+		Time: &tm, Unix: &tm, Duration: &d, Slice: &s, Map: &m}
+
+	str2, i2, u2, f2, b2 := "x", -3, uint8(7), 1.5, true
+	tm2, d2, s2, m2 := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), time.Second, []string{"a"}, map[string]int{"a": 1}
+	unix := time.Unix(tm2.Unix(), 0)
+	full := &PointerTest{ID: "p2", String: &str2, Int: &i2, Uint: &u2, Float: &f2, Bool: &b2,
+		Time: &tm2, Unix: &unix, Duration: &d2, Slice: &s2, Map: &m2}
+
+	for _, model := range []*PointerTest{{ID: "p0"}, zero, full} {
+		err := redisClient.NewQuery().Create(ctx, model)
+		assert.Nil(t, err)
+		result := &PointerTest{ID: model.ID, String: &str2, Int: &i2}
+		err = redisClient.NewQuery().Find(ctx, result)
+		assert.Nil(t, err)
+		assert.Equal(t, model, result)
+	}
+
+	//nil以HMAP中没有该字段表示
+	key := GetTypeFullName(full) + "/ID/p0"
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ID": "p0"}, stored)
+
+	//更新为nil时删除字段
+	key = GetTypeFullName(full) + "/ID/p2"
+	err = redisClient.NewQuery().Updates(ctx, &PointerTest{ID: "p2"}, map[string]interface{}{"String": nil, "Int": (*int)(nil)})
+	assert.Nil(t, err)
+	exists, err := redisClient.client.Do(ctx, "hexists", key, "String").Int64()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), exists)
+	result := &PointerTest{ID: "p2"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Nil(t, result.String)
+	assert.Nil(t, result.Int)
+	assert.Equal(t, full.Bool, result.Bool)
+
+	//Create覆盖已有数据时删除nil字段
+	err = redisClient.NewQuery().Create(ctx, &PointerTest{ID: "p2"})
+	assert.Nil(t, err)
+	stored, err = redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"ID": "p2"}, stored)
+}
@@ -0,0 +1,199 @@
+package rorm
+
+import (
+	"reflect"
+	"sync"
+)
+
+//ModelSchema 结构体类型解析后的元数据 每个类型只解析一次后缓存在schemas中
+//Create Find Update getPrimaryKey等从ModelSchema中读取字段与标签 不再每次调用时反射遍历结构体
+type ModelSchema struct {
+	Type        reflect.Type   //结构体类型 指针类型使用其指向的类型
+	Name        string         //model名称 主键与索引key的前缀 默认为类型全名
+	Layout      StorageLayout  //存储方式
+	Fields      []*SchemaField //需要存储的字段 包括匿名结构体中提升的字段 不包括redis:"-"的字段
+	Primaries   []*SchemaField //redis:"primary"字段 按定义的顺序组成主键
+	Indexes     []*modelIndex  //redis:"index"定义的索引
+	RangeFields []string       //redis:"index:range"定义了范围索引的字段名
+	Version     *SchemaField   //redis:"version"字段 没有时为nil
+
+	SchemaVersion int //RegisterMigration注册的最大版本 没有注册迁移函数时为0
+
+	err           error //标签的使用错误 getPrimaryKey时返回
+	documentCodec DocumentCodec
+	migrations    map[int]Migration
+	byName        map[string]*SchemaField
+	byStored      map[string]*SchemaField
+}
+
+//SchemaField 结构体字段解析后的元数据
+type SchemaField struct {
+	reflect.StructField                   //Index为相对ModelSchema.Type的路径
+	Stored              string            //存储在HMAP中的字段名
+	Tags                map[string]string //解析后的redis标签
+	ForeignKey          string            //foreignKey关联的字段名
+	Codec               Codec             //字段类型使用的Codec
+
+	inline       bool
+	encrypted    bool
+	omitEmpty    bool
+	defaultValue string
+	hasDefault   bool
+}
+
+//newSchemaField 解析结构体字段的标签与Codec 写入与读取时不再重复解析
+func newSchemaField(sf reflect.StructField) *SchemaField {
+	tag := sf.Tag.Get("redis")
+	field := &SchemaField{
+		StructField: sf,
+		Stored:      getFieldName(sf),
+		Tags:        parseRedisTag(tag),
+		ForeignKey:  getForeignKeyName(tag),
+		Codec:       fieldCodec(sf, sf.Type),
+	}
+	_, field.inline = field.Tags["inline"]
+	_, field.encrypted = field.Tags["encrypt"]
+	_, field.omitEmpty = field.Tags["omitempty"]
+	field.defaultValue, field.hasDefault = field.Tags["default"]
+	return field
+}
+
+//codec 得到值的类型为typ时使用的Codec 与字段类型相同时使用缓存的Codec
+func (field *SchemaField) codec(typ reflect.Type) Codec {
+	if typ == field.Type {
+		return field.Codec
+	}
+	return fieldCodec(field.StructField, typ)
+}
+
+//encode 使用字段对应的Codec转换value
+func (field *SchemaField) encode(value reflect.Value) (string, error) {
+	if !value.IsValid() {
+		return "", errSkipField
+	}
+	return field.codec(value.Type()).Encode(value)
+}
+
+//decode 使用字段对应的Codec将data解析到value中
+func (field *SchemaField) decode(data string, value reflect.Value) error {
+	return field.codec(value.Type()).Decode(data, value)
+}
+
+//omitted 字段设置了omitempty且值为零值时不写入
+func (field *SchemaField) omitted(value reflect.Value) bool {
+	return field.omitEmpty && (!value.IsValid() || value.IsZero())
+}
+
+//isNil 字段的值为nil foreignKey关联的子model不存储在HMAP中 不属于nil字段
+func (field *SchemaField) isNil(value reflect.Value) bool {
+	return isNilValue(value) && field.ForeignKey == ""
+}
+
+var schemas sync.Map
+
+//GetModelSchema 得到model类型的ModelSchema
+func GetModelSchema(model interface{}) *ModelSchema {
+	return getSchema(reflect.TypeOf(model))
+}
+
+//getSchema 得到typ的ModelSchema 第一次调用时解析
+func getSchema(typ reflect.Type) *ModelSchema {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if schema, ok := schemas.Load(typ); ok {
+		return schema.(*ModelSchema)
+	}
+	schema, _ := schemas.LoadOrStore(typ, newSchema(typ))
+	return schema.(*ModelSchema)
+}
+
+//resetSchemas 清除缓存的ModelSchema RegisterCodec后字段使用的Codec可能改变
+func resetSchemas() {
+	schemas.Range(func(key, value interface{}) bool {
+		schemas.Delete(key)
+		return true
+	})
+}
+
+//newSchema 解析typ 非结构体类型的ModelSchema中没有字段
+func newSchema(typ reflect.Type) *ModelSchema {
+	schema := &ModelSchema{
+		Type:          typ,
+		Layout:        HashLayout,
+		documentCodec: jsonDocumentCodec{},
+		byName:        map[string]*SchemaField{},
+		byStored:      map[string]*SchemaField{},
+	}
+	model := reflect.New(typ).Interface()
+	schema.Name = getModelName(typ, model)
+	if layoutModel, ok := model.(LayoutModel); ok {
+		schema.Layout = layoutModel.RedisLayout()
+	}
+	if codecModel, ok := model.(DocumentCodecModel); ok && schema.Layout == BlobLayout {
+		schema.documentCodec = codecModel.RedisDocumentCodec()
+	}
+	schema.migrations, schema.SchemaVersion = getMigrations(typ)
+	if typ.Kind() != reflect.Struct {
+		return schema
+	}
+
+	named := map[string]*modelIndex{}
+	for _, sf := range structFields(typ) {
+		tag := sf.Tag.Get("redis")
+		if tag == "-" {
+			continue
+		}
+		field := newSchemaField(sf)
+		schema.Fields = append(schema.Fields, field)
+		schema.byName[sf.Name] = field
+		if _, ok := schema.byStored[field.Stored]; !ok {
+			schema.byStored[field.Stored] = field
+		}
+
+		if _, ok := field.Tags["primary"]; ok {
+			schema.Primaries = append(schema.Primaries, field)
+		}
+		if _, ok := field.Tags["version"]; ok && schema.Version == nil && isIntegerKind(sf.Type.Kind()) {
+			schema.Version = field
+		}
+		name, ok := field.Tags["index"]
+		if !ok {
+			continue
+		}
+		if name == rangeIndexName {
+			schema.RangeFields = append(schema.RangeFields, sf.Name)
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		index, ok := named[name]
+		if !ok {
+			index = &modelIndex{Name: name}
+			named[name] = index
+			schema.Indexes = append(schema.Indexes, index)
+		}
+		index.Fields = append(index.Fields, sf.Name)
+	}
+	schema.err = checkEncryptTags(schema)
+	return schema
+}
+
+//lookup 根据Go中的字段名或存储的字段名查找字段 Go中的字段名优先
+func (schema *ModelSchema) lookup(name string) (*SchemaField, bool) {
+	if field, ok := schema.byName[name]; ok {
+		return field, true
+	}
+	field, ok := schema.byStored[name]
+	return field, ok
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package rorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type SchemaBench struct {
+	EmbedBase
+	Name    string `redis:"index;name:n"`
+	Score   int    `redis:"index:range"`
+	Email   string `redis:"omitempty"`
+	Tags    []string
+	Expires *time.Time    `redis:"time:unix"`
+	Address InlineAddress `redis:"inline"`
+}
+
+func newSchemaBench() *SchemaBench {
+	expires := time.Unix(1600000000, 0)
+	return &SchemaBench{
+		EmbedBase: EmbedBase{ID: "bench1", Version: 3, CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		Name:      "alice",
+		Score:     10,
+		Tags:      []string{"a", "b"},
+		Expires:   &expires,
+		Address:   InlineAddress{City: "Hangzhou", Zip: 310000},
+	}
+}
+
+func TestGetModelSchema(t *testing.T) {
+	schema := GetModelSchema(&SchemaBench{})
+	assert.Same(t, schema, GetModelSchema(SchemaBench{}))
+	assert.Equal(t, GetTypeFullName(&SchemaBench{}), schema.Name)
+	assert.Equal(t, HashLayout, schema.Layout)
+
+	names := make([]string, 0, len(schema.Fields))
+	for _, field := range schema.Fields {
+		names = append(names, field.Stored)
+	}
+	assert.Equal(t, []string{"ID", "Version", "CreatedAt", "n", "Score", "Email", "Tags", "Expires", "Address"}, names)
+	if assert.Len(t, schema.Primaries, 1) {
+		assert.Equal(t, []int{0, 0}, schema.Primaries[0].Index)
+	}
+	assert.Equal(t, "Version", schema.Version.Name)
+	assert.Equal(t, []*modelIndex{{Name: "Name", Fields: []string{"Name"}}}, schema.Indexes)
+	assert.Equal(t, []string{"Score"}, schema.RangeFields)
+	assert.Equal(t, ptrCodec{elem: unixTimeCodec{}}, schema.Fields[7].Codec)
+
+	field, ok := schema.lookup("n")
+	assert.True(t, ok)
+	assert.Equal(t, "Name", field.Name)
+
+	//RegisterCodec后重新解析
+	RegisterCodec(reflect.TypeOf(Celsius(0)), celsiusCodec{})
+	assert.NotSame(t, schema, GetModelSchema(&SchemaBench{}))
+}
+
+func BenchmarkGetPrimaryKey(b *testing.B) {
+	query := redisClient.NewQuery()
+	model := newSchemaBench()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := query.getPrimaryKey(model); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertStructToMap(b *testing.B) {
+	model := newSchemaBench()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ConvertStructToMap(model)
+	}
+}
+
+func BenchmarkRetrieveData(b *testing.B) {
+	query := redisClient.NewQuery()
+	data := ConvertStructToMap(newSchemaBench())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := query.retrieveData("", data, &SchemaBench{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkModelIndexes(b *testing.B) {
+	model := newSchemaBench()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		getModelIndexes(reflect.TypeOf(model))
+		getRangeIndexFields(reflect.TypeOf(model))
+		getVersionField(reflect.TypeOf(model))
+	}
+}
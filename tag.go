@@ -0,0 +1,35 @@
+package rorm
+
+import (
+	"reflect"
+)
+
+//redis标签中与字段存储相关的选项 多个选项以;分隔 例如 redis:"name:u;omitempty;default:42"
+//  name:u      存储在HMAP中的字段名 默认为Go中的字段名 使用更短的名称可以节省内存
+//  omitempty   值为零值时不写入 已存储的值会被删除
+//  default:42  Find时HMAP中没有该字段则使用默认值 默认值的格式与存储的格式相同
+
+//getFieldName 得到字段存储在HMAP中的名称
+func getFieldName(sf reflect.StructField) string {
+	if name := parseRedisTag(sf.Tag.Get("redis"))["name"]; name != "" {
+		return name
+	}
+	return sf.Name
+}
+
+//isPrimaryField 字段是否为主键
+func isPrimaryField(sf reflect.StructField) bool {
+	_, ok := parseRedisTag(sf.Tag.Get("redis"))["primary"]
+	return ok
+}
+
+//storedFieldName 得到typ中Go字段名对应的存储名称 字段不存在时返回原名称
+func storedFieldName(typ reflect.Type, name string) string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if field, ok := lookupField(typ, name); ok {
+		return field.stored
+	}
+	return name
+}
@@ -0,0 +1,81 @@
+package rorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type TagTest struct {
+	ID       string        `redis:"primary;name:i"`
+	Nickname string        `redis:"name:n;omitempty"`
+	Level    int           `redis:"name:l;default:42"`
+	Note     string        `redis:"omitempty;default:none"`
+	Address  InlineAddress `redis:"inline;name:a"`
+}
+
+func TestQuery_TagOptions(t *testing.T) {
+	ctx := context.Background()
+	model := &TagTest{ID: "tag1", Level: 3, Address: InlineAddress{City: "Hangzhou"}}
+
+	key, err := redisClient.NewQuery().getPrimaryKey(model)
+	assert.Nil(t, err)
+	assert.Equal(t, GetTypeFullName(model)+"/i/tag1", key)
+
+	err = redisClient.NewQuery().Create(ctx, model)
+	assert.Nil(t, err)
+	stored, err := redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"i":         "tag1",
+		"l":         "3",
+		"a.City":    "Hangzhou",
+		"a.Zip":     "0",
+		"a.Geo.Lat": "0",
+		"a.Geo.Lng": "0",
+	}, stored)
+
+	//没有存储的字段使用默认值
+	err = redisClient.client.Do(ctx, "hdel", key, "l").Err()
+	assert.Nil(t, err)
+	result := &TagTest{ID: "tag1"}
+	err = redisClient.NewQuery().Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, result.Level)
+	assert.Equal(t, "none", result.Note)
+	assert.Equal(t, "", result.Nickname)
+
+	//Update可以使用Go中的字段名或存储的字段名
+	err = redisClient.NewQuery().Update(ctx, &TagTest{ID: "tag1"}, "Nickname", "bob")
+	assert.Nil(t, err)
+	err = redisClient.NewQuery().Updates(ctx, &TagTest{ID: "tag1"}, map[string]interface{}{"l": 7, "a.City": "Ningbo"})
+	assert.Nil(t, err)
+	stored, err = redisClient.client.HGetAll(ctx, key).Result()
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", stored["n"])
+	assert.Equal(t, "7", stored["l"])
+	assert.Equal(t, "Ningbo", stored["a.City"])
+
+	result = &TagTest{ID: "tag1"}
+	err = redisClient.NewQuery().Select("Nickname", "a.City").Find(ctx, result)
+	assert.Nil(t, err)
+	assert.Equal(t, &TagTest{ID: "tag1", Nickname: "bob", Address: InlineAddress{City: "Ningbo"}}, result)
+
+	var levels []int
+	err = redisClient.NewQuery().Where(GetTypeFullName(model)+"/i/tag*").Model(&TagTest{}).Pluck(ctx, "Level", &levels)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{7}, levels)
+	//没有存储的字段与Find相同使用默认值
+	var notes []string
+	err = redisClient.NewQuery().Where(GetTypeFullName(model)+"/i/tag*").Model(&TagTest{}).Pluck(ctx, "Note", &notes)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"none"}, notes)
+
+	//omitempty的字段更新为零值时删除
+	err = redisClient.NewQuery().Update(ctx, &TagTest{ID: "tag1"}, "n", "")
+	assert.Nil(t, err)
+	exists, err := redisClient.client.Do(ctx, "hexists", key, "n").Int64()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), exists)
+}
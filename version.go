@@ -0,0 +1,99 @@
+package rorm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrStaleVersion    = errors.New("record has been modified by another writer")
+	ErrVersionReadOnly = errors.New("version field can not be updated directly")
+)
+
+//getVersionField 得到标记了redis:"version"的整数字段
+func getVersionField(typ reflect.Type) (field reflect.StructField, ok bool) {
+	if version := getSchema(typ).Version; version != nil {
+		return version.StructField, true
+	}
+	return
+}
+
+func getVersionValue(value reflect.Value) int64 {
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint())
+	default:
+		return value.Int()
+	}
+}
+
+func setVersionValue(value reflect.Value, version int64) {
+	switch value.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value.SetUint(uint64(version))
+	default:
+		value.SetInt(version)
+	}
+}
+
+//execUpdate 在pipeline中执行write
+//model定义了redis:"version"字段时 使用WATCH/MULTI比较model中的版本与redis中存储的版本
+//版本一致时写入数据并将版本加1 写回model 否则返回ErrStaleVersion
+func (query *Query) execUpdate(ctx context.Context, hashKey string, model interface{}, write func(pipe redis.Pipeliner) error) (err error) {
+	typ := reflect.TypeOf(model)
+	versionField, ok := getVersionField(typ)
+	if !ok {
+		//write在WATCH之后读取旧的索引值 期间数据被修改时重试 避免并发更新留下多余的索引
+		for retry := 0; retry < 3; retry++ {
+			err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+				_, err := tx.TxPipelined(ctx, write)
+				return err
+			}, hashKey)
+			if err != redis.TxFailedErr {
+				break
+			}
+		}
+		return
+	}
+
+	versionValue := fieldByIndex(reflect.ValueOf(model).Elem(), versionField.Index, true)
+	getArgs, incrArgs := versionArgs(getLayout(typ), typ, hashKey, versionField)
+	var incrCmd *redis.Cmd
+
+	err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+		getCmd := redis.NewCmd(ctx, getArgs...)
+		if err := tx.Process(ctx, getCmd); err != nil && err != redis.Nil {
+			return err
+		}
+		stored, err := parseStoredVersion(getCmd)
+		if err != nil {
+			return err
+		}
+		if stored != getVersionValue(versionValue) {
+			return ErrStaleVersion
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if err := write(pipe); err != nil {
+				return err
+			}
+			incrCmd = pipe.Do(ctx, incrArgs...)
+			return nil
+		})
+		return err
+	}, hashKey)
+
+	if err == redis.TxFailedErr {
+		return ErrStaleVersion
+	} else if err != nil {
+		return
+	}
+	version, err := incrCmd.Int64()
+	if err != nil {
+		return
+	}
+	setVersionValue(versionValue, version)
+	return
+}
@@ -0,0 +1,80 @@
+package rorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type VersionTest struct {
+	ID      string `redis:"primary"`
+	PayLoad string
+	Version int64 `redis:"version"`
+}
+
+func TestQuery_UpdateVersion(t *testing.T) {
+	ctx := context.Background()
+	if err := redisClient.NewQuery().Create(ctx, &VersionTest{ID: "version1", PayLoad: "init"}); err != nil {
+		t.Fatalf("Query.Create() error = %v", err)
+	}
+
+	first := &VersionTest{ID: "version1"}
+	stale := &VersionTest{ID: "version1"}
+
+	tests := []struct {
+		name        string
+		update      func() error
+		wantErr     error
+		model       *VersionTest
+		wantVersion int64
+	}{
+		{
+			name: "update with current version",
+			update: func() error {
+				return redisClient.NewQuery().Update(ctx, first, "PayLoad", "first")
+			},
+			model:       first,
+			wantVersion: 1,
+		},
+		{
+			name: "update with stale version",
+			update: func() error {
+				return redisClient.NewQuery().Update(ctx, stale, "PayLoad", "stale")
+			},
+			wantErr:     ErrStaleVersion,
+			model:       stale,
+			wantVersion: 0,
+		},
+		{
+			name: "updates with current version",
+			update: func() error {
+				return redisClient.NewQuery().Updates(ctx, first, map[string]interface{}{"PayLoad": "second"})
+			},
+			model:       first,
+			wantVersion: 2,
+		},
+		{
+			name: "update version field directly",
+			update: func() error {
+				return redisClient.NewQuery().Update(ctx, first, "Version", 10)
+			},
+			wantErr:     ErrVersionReadOnly,
+			model:       first,
+			wantVersion: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.update()
+			assert.Equal(t, tt.wantErr, err)
+			assert.Equal(t, tt.wantVersion, tt.model.Version)
+		})
+	}
+
+	result := &VersionTest{ID: "version1"}
+	if err := redisClient.NewQuery().Find(ctx, result); err != nil {
+		t.Fatalf("Query.Find() error = %v", err)
+	}
+	assert.Equal(t, &VersionTest{ID: "version1", PayLoad: "second", Version: 2}, result)
+}
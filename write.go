@@ -0,0 +1,139 @@
+package rorm
+
+import (
+	"context"
+	"reflect"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+//WriteMode Create写入数据的方式
+type WriteMode uint
+
+const (
+	_          WriteMode = iota
+	Upsert               //数据存在则覆盖 不存在则新建 默认方式
+	InsertOnly           //数据已存在时返回ErrDuplicateKey
+	UpdateOnly           //数据不存在时返回RormPrimaryKeyNotFound
+)
+
+//Mode 设置Create写入数据的方式
+func (query *Query) Mode(mode WriteMode) *Query {
+	query.CreateMode = mode
+	return query
+}
+
+//Save 写入数据 数据存在则覆盖 不存在则新建 不受Mode影响
+func (query *Query) Save(ctx context.Context, v interface{}) (err error) {
+	if err = callBeforeCreate(ctx, v); err != nil {
+		return
+	}
+
+	if err = query.fillAutoKeys(ctx, v); err != nil {
+		return
+	}
+	key, err := query.getPrimaryKey(v)
+	if err != nil {
+		return
+	}
+
+	//索引的旧值在WATCH之后读取 与数据一起在MULTI中写入 期间数据被修改时重试
+	for retry := 0; retry < 3; retry++ {
+		err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+			_, err := tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				_, err := query.pipeCreate(ctx, pipe, v)
+				return err
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+	return callAfterCreate(ctx, v)
+}
+
+//guardedCreate 以InsertOnly或UpdateOnly方式写入数据
+//在WATCH中检查数据是否存在 数据 索引与关联的子model在同一个MULTI中写入 期间数据被修改时重试
+//UpdateOnly时model定义了redis:"version"字段则与Update相同 版本一致时写入并将版本加1 否则返回ErrStaleVersion
+func (query *Query) guardedCreate(ctx context.Context, v interface{}) (err error) {
+	if err = callBeforeCreate(ctx, v); err != nil {
+		return
+	}
+
+	if err = query.fillAutoKeys(ctx, v); err != nil {
+		return
+	}
+	key, err := query.getPrimaryKey(v)
+	if err != nil {
+		return
+	}
+
+	typ := reflect.TypeOf(v)
+	versionField, versioned := getVersionField(typ)
+	versioned = versioned && query.CreateMode == UpdateOnly
+	var versionValue reflect.Value
+	var getArgs, incrArgs []interface{}
+	var incrCmd *redis.Cmd
+	if versioned {
+		versionValue = fieldByIndex(reflect.ValueOf(v).Elem(), versionField.Index, true)
+		getArgs, incrArgs = versionArgs(getLayout(typ), typ, key, versionField)
+	}
+
+	for retry := 0; retry < 3; retry++ {
+		err = query.client.Watch(ctx, func(tx *redis.Tx) error {
+			exists, err := tx.Exists(ctx, key).Result()
+			if err != nil {
+				return err
+			}
+			if query.CreateMode == InsertOnly && exists > 0 {
+				return ErrDuplicateKey
+			}
+			if query.CreateMode == UpdateOnly && exists == 0 {
+				return RormPrimaryKeyNotFound
+			}
+			if versioned {
+				getCmd := redis.NewCmd(ctx, getArgs...)
+				if err := tx.Process(ctx, getCmd); err != nil && err != redis.Nil {
+					return err
+				}
+				stored, err := parseStoredVersion(getCmd)
+				if err != nil {
+					return err
+				}
+				if stored != getVersionValue(versionValue) {
+					return ErrStaleVersion
+				}
+			}
+			//索引的旧值在WATCH之后读取 与数据一起在MULTI中写入
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				if _, err := query.pipeCreate(ctx, pipe, v); err != nil {
+					return err
+				}
+				if versioned {
+					incrCmd = pipe.Do(ctx, incrArgs...)
+				}
+				return nil
+			})
+			return err
+		}, key)
+		if err != redis.TxFailedErr {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if versioned {
+		version, err := incrCmd.Int64()
+		if err != nil {
+			return err
+		}
+		setVersionValue(versionValue, version)
+	}
+	return callAfterCreate(ctx, v)
+}
@@ -0,0 +1,138 @@
+package rorm
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuery_CreateMode(t *testing.T) {
+	ctx := context.Background()
+	testStringPtr := "testStringPtr"
+	redisClient.NewQuery().Delete(ctx, &RedisTest{ID: "mode1"})
+	redisClient.NewQuery().Delete(ctx, &RedisTest{ID: "mode2"})
+
+	tests := []struct {
+		name    string
+		query   *Query
+		model   *RedisTest
+		wantErr error
+	}{
+		{
+			name:    "insert only with new key",
+			query:   redisClient.NewQuery().Mode(InsertOnly),
+			model:   &RedisTest{ID: "mode1", PayLoad: "first", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+			wantErr: nil,
+		},
+		{
+			name:    "insert only with existing key",
+			query:   redisClient.NewQuery().Mode(InsertOnly),
+			model:   &RedisTest{ID: "mode1", PayLoad: "second", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "update only with existing key",
+			query:   redisClient.NewQuery().Mode(UpdateOnly),
+			model:   &RedisTest{ID: "mode1", PayLoad: "third", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+			wantErr: nil,
+		},
+		{
+			name:    "update only with key not exist",
+			query:   redisClient.NewQuery().Mode(UpdateOnly),
+			model:   &RedisTest{ID: "mode2", PayLoad: "first", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+			wantErr: RormPrimaryKeyNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Create(ctx, tt.model)
+			assert.Equal(t, tt.wantErr, err)
+		})
+	}
+
+	result := &RedisTest{ID: "mode1"}
+	assert.Nil(t, redisClient.NewQuery().Find(ctx, result))
+	assert.Equal(t, "third", result.PayLoad)
+	assert.Equal(t, RormDataNotFound, redisClient.NewQuery().Find(ctx, &RedisTest{ID: "mode2"}))
+}
+
+func TestQuery_CreateInsertOnlyConcurrent(t *testing.T) {
+	ctx := context.Background()
+	testStringPtr := "testStringPtr"
+	redisClient.NewQuery().Delete(ctx, &RedisTest{ID: "mode3"})
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			model := &RedisTest{ID: "mode3", TEST: i, PTRTEST: &testStringPtr, TestStruct: &TestStruct{}}
+			errs[i] = redisClient.NewQuery().Mode(InsertOnly).Create(ctx, model)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+		} else {
+			assert.Equal(t, ErrDuplicateKey, err)
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestQuery_CreateManyMode(t *testing.T) {
+	ctx := context.Background()
+	testStringPtr := "testStringPtr"
+	redisClient.NewQuery().Delete(ctx, &RedisTest{ID: "mode4"})
+	redisClient.NewQuery().Delete(ctx, &RedisTest{ID: "mode5"})
+	err := redisClient.NewQuery().Create(ctx, &RedisTest{ID: "mode4", PayLoad: "first", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}})
+	assert.Nil(t, err)
+
+	models := []*RedisTest{
+		{ID: "mode4", PayLoad: "second", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+		{ID: "mode5", PayLoad: "second", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}},
+	}
+	errs, err := redisClient.NewQuery().Mode(InsertOnly).CreateMany(ctx, models)
+	assert.NotNil(t, err)
+	assert.Equal(t, []error{ErrDuplicateKey, nil}, errs)
+	result := &RedisTest{ID: "mode4"}
+	assert.Nil(t, redisClient.NewQuery().Find(ctx, result))
+	assert.Equal(t, "first", result.PayLoad)
+
+	models[1].PayLoad = "third"
+	models = append(models, &RedisTest{ID: "mode6", PTRTEST: &testStringPtr, TestStruct: &TestStruct{}})
+	errs, err = redisClient.NewQuery().Mode(UpdateOnly).CreateMany(ctx, models)
+	assert.NotNil(t, err)
+	assert.Equal(t, []error{nil, nil, RormPrimaryKeyNotFound}, errs)
+	result = &RedisTest{ID: "mode5"}
+	assert.Nil(t, redisClient.NewQuery().Find(ctx, result))
+	assert.Equal(t, "third", result.PayLoad)
+	assert.Equal(t, RormDataNotFound, redisClient.NewQuery().Find(ctx, &RedisTest{ID: "mode6"}))
+}
+
+func TestQuery_CreateModeVersion(t *testing.T) {
+	ctx := context.Background()
+	redisClient.NewQuery().Delete(ctx, &VersionTest{ID: "modever1"})
+	err := redisClient.NewQuery().Create(ctx, &VersionTest{ID: "modever1", PayLoad: "first"})
+	assert.Nil(t, err)
+
+	//UpdateOnly与Update相同 比较并增加版本
+	model := &VersionTest{ID: "modever1", PayLoad: "second"}
+	err = redisClient.NewQuery().Mode(UpdateOnly).Create(ctx, model)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), model.Version)
+
+	stale := &VersionTest{ID: "modever1", PayLoad: "stale"}
+	err = redisClient.NewQuery().Mode(UpdateOnly).Create(ctx, stale)
+	assert.Equal(t, ErrStaleVersion, err)
+
+	result := &VersionTest{ID: "modever1"}
+	assert.Nil(t, redisClient.NewQuery().Find(ctx, result))
+	assert.Equal(t, model, result)
+}